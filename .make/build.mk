@@ -33,7 +33,7 @@ endif
 
 .PHONY=test
 test: _bindir prebuild  ## run unit tests with code coverage info
-	$(GOTEST) -cover -coverprofile=$(GOOUTDIR)/cover.out -covermode=atomic ./...
+	$(GOTEST) $(GOTAGS) -cover -coverprofile=$(GOOUTDIR)/cover.out -covermode=atomic ./...
 	$(GOTOOL) cover -html=$(GOOUTDIR)/cover.out -o $(GOOUTDIR)/cover.html
 
 .PHONY=check
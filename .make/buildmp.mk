@@ -1,4 +1,9 @@
 GOBUILDOUTMP=-o bin/${@:build.go/%=%}$(BINARY_EXT)
+MANIFEST_NAME=releases.json
+# MANIFEST_BASE_URL is the location of the published releases, the assets
+# of a release are expected under $(MANIFEST_BASE_URL)/<version>/
+MANIFEST_BASE_URL?=
+METADATA_EXPIRY?=0
 
 TARGETS:= $(foreach P,$(BINARIES:./cmd/%=%),$(addprefix $P-,$(BUILDS)))
 
@@ -14,11 +19,27 @@ ifeq ($(MSIGN_SIGNATURE),yes)
 	$(MSIGN) sign --to-file bin/${@:build.go/%=%}$(BINARY_EXT)
 endif
 
+.PHONY=manifest
+manifest: tools.msign prebuild ## generate release manifest for binaries in bin/
+ifneq ($(METADATA_EXPIRY),0)
+	$(GOCMD) run ./cmd/release_manifest --dir $(GOOUTDIR) --version $(BUILDNUMBER) --metadata-only --metadata-expiry $(METADATA_EXPIRY)
+ifeq ($(MSIGN_SIGNATURE),yes)
+	for f in $(GOOUTDIR)/*.metadata.json; do if [ -f "$$f" ]; then $(MSIGN) sign --to-file "$$f"; fi; done
+endif
+endif
+	$(GOCMD) run ./cmd/release_manifest --dir $(GOOUTDIR) --version $(BUILDNUMBER) --base-url "$(if $(MANIFEST_BASE_URL),$(MANIFEST_BASE_URL)/$(BUILDNUMBER))"
+ifeq ($(MSIGN_SIGNATURE),yes)
+	$(MSIGN) sign --to-file $(GOOUTDIR)/$(MANIFEST_NAME)
+endif
+
 .PHONY=cleanmp cleanmp/%
 cleanmp: $(TARGETS:%=cleanmp/%) ## clean up files
 	$(GOCLEAN)
 	rm -f $(GOOUTDIR)/cover.out
 	rm -f $(GOOUTDIR)/cover.html
+	rm -f $(GOOUTDIR)/$(MANIFEST_NAME)
+	rm -f $(GOOUTDIR)/$(MANIFEST_NAME).msign
+	rm -f $(GOOUTDIR)/*.metadata.json $(GOOUTDIR)/*.metadata.json.msign
 
 cleanmp/%: BINARY_EXT = $(if $(filter windows, $(word 2,$(subst -, ,$*))),.exe,$(EMPTY))
 cleanmp/%:
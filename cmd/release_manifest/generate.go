@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.melnyk.org/selfupdate-test/internal/selfupdate"
+)
+
+var (
+	genDir        string
+	genVersion    string
+	genName       string
+	genBaseURL    string
+	genOutput     string
+	genPreRelease bool
+	genExpiry     time.Duration
+	genMetadata   bool
+)
+
+var (
+	// knownOS lists GOOS values accepted in binary names.
+	knownOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true,
+		"freebsd": true, "illumos": true, "ios": true, "linux": true,
+		"netbsd": true, "openbsd": true, "plan9": true, "solaris": true,
+		"windows": true,
+	}
+)
+
+const (
+	signExt = ".msign"
+	exeExt  = ".exe"
+)
+
+func runGenerate(cmd *cobra.Command, args []string) error {
+	if genVersion == "" {
+		return errors.New("version is required")
+	}
+
+	// Metadata is signed before the manifest listing it is generated
+	if genMetadata {
+		if genExpiry <= 0 {
+			return errors.New("metadata expiry is required")
+		}
+		return generateMetadata(genDir, time.Now().Add(genExpiry))
+	}
+
+	output := genOutput
+	if output == "" {
+		output = filepath.Join(genDir, selfupdate.ManifestName)
+	}
+
+	release, err := generate(genDir, output)
+	if err != nil {
+		return err
+	}
+
+	// Keep releases from the previous manifest, if any
+	var manifest selfupdate.Manifest
+	if cont, err := os.ReadFile(output); err == nil {
+		if err = json.Unmarshal(cont, &manifest); err != nil {
+			return fmt.Errorf("%s: %w", output, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Releases sharing asset URLs with the new one (e.g. relative to the
+	// same directory) point to the replaced files, so they are dropped
+	urls := map[string]bool{}
+	for _, asset := range release.Assets {
+		urls[asset.URL] = true
+	}
+
+	releases := []selfupdate.ManifestRelease{release}
+	for _, r := range manifest.Releases {
+		if r.Version == release.Version {
+			continue
+		}
+
+		if asset, ok := replacedAsset(r, urls); ok {
+			fmt.Printf("Release %s is dropped, asset %s is replaced\n", r.Version, asset.URL)
+			continue
+		}
+
+		releases = append(releases, r)
+	}
+	manifest.Releases = releases
+
+	cont, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	cont = append(cont, '\n')
+
+	if err = os.WriteFile(output, cont, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Manifest %s: release %s with %d assets\n", output, release.Version, len(release.Assets))
+
+	return nil
+}
+
+// replacedAsset returns the asset of release with URL in urls.
+func replacedAsset(release selfupdate.ManifestRelease, urls map[string]bool) (selfupdate.ManifestAsset, bool) {
+	for _, asset := range release.Assets {
+		if urls[asset.URL] {
+			return asset, true
+		}
+	}
+	return selfupdate.ManifestAsset{}, false
+}
+
+// generate collects release assets from binaries (and their signatures)
+// in dir, skipping the manifest itself.
+func generate(dir string, manifest string) (selfupdate.ManifestRelease, error) {
+	release := selfupdate.ManifestRelease{
+		Version:     genVersion,
+		Name:        genName,
+		PreRelease:  genPreRelease,
+		PublishedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return release, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || name == filepath.Base(manifest) || name == filepath.Base(manifest)+signExt {
+			continue
+		}
+
+		goos, goarch, ok := platform(name)
+		if !ok {
+			continue
+		}
+
+		size, sum, err := digest(filepath.Join(dir, name))
+		if err != nil {
+			return release, err
+		}
+
+		release.Assets = append(release.Assets, selfupdate.ManifestAsset{
+			Name:   name,
+			GOOS:   goos,
+			GOARCH: goarch,
+			URL:    assetURL(name),
+			Size:   size,
+			SHA256: sum,
+		})
+	}
+
+	if len(release.Assets) == 0 {
+		return release, fmt.Errorf("no binaries found in %s", dir)
+	}
+
+	return release, nil
+}
+
+// generateMetadata writes release metadata, expiring at expires, next to
+// every binary in dir. The metadata should be signed like the binaries
+// before the manifest is generated.
+func generateMetadata(dir string, expires time.Time) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasSuffix(name, signExt) || strings.HasSuffix(name, selfupdate.MetadataExt) {
+			continue
+		}
+
+		goos, goarch, ok := platform(name)
+		if !ok {
+			continue
+		}
+
+		_, sum, err := digest(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		cont, err := json.MarshalIndent(selfupdate.Metadata{
+			Version:  genVersion,
+			Platform: goos + "/" + goarch,
+			Binary:   name,
+			SHA256:   sum,
+			Expires:  expires.UTC().Truncate(time.Second),
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err = os.WriteFile(filepath.Join(dir, name+selfupdate.MetadataExt), append(cont, '\n'), 0644); err != nil {
+			return err
+		}
+
+		fmt.Printf("Metadata %s: release %s expires at %s\n", name+selfupdate.MetadataExt, genVersion, expires.UTC().Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// platform extracts GOOS and GOARCH from binary names produced by
+// make buildmp, e.g. app-linux-amd64, app-windows-arm64.exe.msign,
+// app-linux-arm64.metadata.json
+func platform(name string) (string, string, bool) {
+	name = strings.TrimSuffix(name, signExt)
+	name = strings.TrimSuffix(name, selfupdate.MetadataExt)
+	name = strings.TrimSuffix(name, exeExt)
+
+	parts := strings.Split(name, "-")
+	if len(parts) < 3 {
+		return "", "", false
+	}
+
+	goos, goarch := parts[len(parts)-2], parts[len(parts)-1]
+	if !knownOS[goos] || goarch == "" {
+		return "", "", false
+	}
+
+	return goos, goarch, true
+}
+
+func assetURL(name string) string {
+	if genBaseURL == "" {
+		return url.PathEscape(name)
+	}
+	return strings.TrimSuffix(genBaseURL, "/") + "/" + url.PathEscape(name)
+}
+
+func digest(file string) (int64, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func init() {
+	rootCmd.Flags().StringVar(&genDir, "dir", "bin", "directory with binaries and .msign files")
+	rootCmd.Flags().StringVar(&genVersion, "version", "", "release version (tag)")
+	rootCmd.Flags().StringVar(&genName, "name", "", "release name")
+	rootCmd.Flags().StringVar(&genBaseURL, "base-url", "", "URL prefix of the release assets, relative to the manifest if not set; previous releases with the same asset URLs are dropped")
+	rootCmd.Flags().StringVar(&genOutput, "output", "", "manifest file, "+selfupdate.ManifestName+" in the binaries directory if not set")
+	rootCmd.Flags().BoolVar(&genPreRelease, "prerelease", false, "mark the release as a prerelease")
+	rootCmd.Flags().BoolVar(&genMetadata, "metadata-only", false, "write release metadata of binaries instead of the manifest")
+	rootCmd.Flags().DurationVar(&genExpiry, "metadata-expiry", 0, "expiry duration of the release metadata (e.g. 720h)")
+}
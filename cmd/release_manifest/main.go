@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var rootCmd = &cobra.Command{
+	Use:          filepath.Base(os.Args[0]),
+	Short:        filepath.Base(os.Args[0]) + " generates self-update release manifest",
+	Long:         "",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runGenerate,
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(-1)
+	}
+}
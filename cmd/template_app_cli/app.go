@@ -0,0 +1,5 @@
+package main
+
+const (
+	appshortname = "appcli"
+)
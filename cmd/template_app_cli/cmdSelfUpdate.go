@@ -4,12 +4,47 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"go.melnyk.org/selfupdate-test/internal/selfupdate"
 )
 
+// Exit codes of self-update commands, so scripts could distinguish
+// the failure reasons.
+const (
+	exitRateLimited = 3
+	exitNotFound    = 4
+	exitNetwork     = 5
+	exitHealthCheck = 6
+	exitSignature   = 7
+	exitMetadata    = 8
+	exitRevoked     = 9
+)
+
+// selfcheckCmdName is the hidden command used for the health check of
+// installed updates.
+const selfcheckCmdName = "self-check"
+
+var (
+	selfupdateProvider  string
+	selfupdateAPIURL    string
+	selfupdateManifest  string
+	selfupdateFrom      string
+	selfupdateTokenFile string
+	selfupdateChannel   string
+	selfupdateDowngrade bool
+	selfupdateVersion   string
+	selfupdateProgress  string
+	selfupdateDryRun    bool
+	selfupdateNoCheck   bool
+	selfupdateVerify    string
+)
+
 var selfupdateCmd = &cobra.Command{
 	Use:   "self-update",
 	Short: "Self Update operation",
@@ -26,11 +61,33 @@ var selfupdateCheckCmd = &cobra.Command{
 	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Println("Current version:   ", buildnumber)
-		latest, err := selfupdate.GetLatestVersion(giturl)
+		conf, err := selfupdateConfig()
+		if err != nil {
+			return err
+		}
+		src, err := selfupdateSource(conf)
+		if err != nil {
+			return err
+		}
+		updater, err := selfupdateUpdater(conf, selfupdate.WithSource(src))
+		if err != nil {
+			return err
+		}
+		res, err := updater.Check(cmd.Context())
 		if err == nil {
-			fmt.Println("Available version: ", latest)
+			fmt.Println("Available version: ", res.Candidate.TagName)
+			if res.Revoked != nil {
+				fmt.Println("Available version is revoked:", revocationReason(res.Revoked))
+			}
+			if res.CurrentRevoked != nil {
+				fmt.Println("Warning: current version is revoked:", revocationReason(res.CurrentRevoked))
+			}
 		}
-		return err
+		var rateErr *selfupdate.RateLimitError
+		if errors.As(err, &rateErr) && !rateErr.Reset.IsZero() {
+			fmt.Println("Rate limited, retry after:", rateErr.Reset.Local().Format("2006-01-02 15:04:05"))
+		}
+		return selfupdateError(err)
 	},
 }
 
@@ -40,13 +97,307 @@ var selfupdateDownloadCmd = &cobra.Command{
 	Long:         ``,
 	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		err := selfupdate.DownloadLatestVersion(giturl, binary, buildnumber)
-		return err
+		conf, err := selfupdateConfig()
+		if err != nil {
+			return err
+		}
+		src, err := selfupdateSource(conf)
+		if err != nil {
+			return err
+		}
+		progress, err := selfupdateProgressFunc(selfupdateProgress)
+		if err != nil {
+			return err
+		}
+		opts := []selfupdate.Option{
+			selfupdate.WithSource(src),
+			selfupdate.WithVersion(selfupdateVersion),
+			selfupdate.WithAllowDowngrade(selfupdateDowngrade),
+			selfupdate.WithDryRun(selfupdateDryRun),
+			selfupdate.WithProgress(progress),
+		}
+		if conf.HealthCheck && !selfupdateNoCheck {
+			opts = append(opts,
+				selfupdate.WithHealthCheck(selfupdate.DefaultHealthCheckTimeout, selfcheckCmdName),
+				selfupdate.WithHealthCheckSince(conf.HealthCheckSince))
+		}
+		updater, err := selfupdateUpdater(conf, opts...)
+		if err != nil {
+			return err
+		}
+		res, err := updater.Apply(cmd.Context())
+		if err != nil {
+			return selfupdateError(err)
+		}
+		if selfupdateProgress == progressJSON {
+			return writeJSONResult(os.Stdout, res)
+		}
+		fmt.Println(res)
+		printVerification(res.Verification)
+		for _, step := range res.Plan {
+			fmt.Println("  ", step)
+		}
+		if res.Action == selfupdate.ActionUpdated && res.Backup == nil {
+			fmt.Println("Backup of the replaced binary is kept as", res.Target+".bak")
+		}
+		if res.Keyring != nil {
+			fmt.Println("Trusted keys are updated:", strings.Join(res.Keyring.IDs(), ", "))
+		}
+		return nil
 	},
 }
 
+var selfupdateRollbackCmd = &cobra.Command{
+	Use:          "rollback",
+	Short:        "Restore binary replaced by the last update (or a retained version)",
+	Long:         ``,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, err := selfupdateConfig()
+		if err != nil {
+			return err
+		}
+		src, err := selfupdateSource(conf)
+		if err != nil {
+			return err
+		}
+		updater, err := selfupdateUpdater(conf,
+			selfupdate.WithSource(src),
+			selfupdate.WithProgress(selfupdate.LineProgress(os.Stdout)),
+		)
+		if err != nil {
+			return err
+		}
+		res, err := updater.Rollback(cmd.Context(), selfupdateVersion)
+		if err != nil {
+			return selfupdateError(err)
+		}
+		if !res.Verified {
+			fmt.Println("Backup signature is not known, verification skipped")
+		}
+		printVerification(res.Verification)
+		restored := res.Restored.Version
+		if restored == "" {
+			restored = "unknown"
+		}
+		fmt.Println("Restored version:  ", restored)
+		return nil
+	},
+}
+
+var selfupdateHistoryCmd = &cobra.Command{
+	Use:          "history",
+	Short:        "List retained backups of previous binaries",
+	Long:         ``,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conf, err := selfupdateConfig()
+		if err != nil {
+			return err
+		}
+		updater, err := selfupdateUpdater(conf)
+		if err != nil {
+			return err
+		}
+		backups, err := updater.History()
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			fmt.Println("No backups")
+			return nil
+		}
+		fmt.Printf("%-20s %-20s %-20s %s\n", "VERSION", "INSTALLED", "REPLACED", "SHA256")
+		for _, backup := range backups {
+			version := backup.Version
+			if version == "" {
+				version = "unknown"
+			}
+			fmt.Printf("%-20s %-20s %-20s %s\n", version,
+				backup.InstalledAt.Local().Format("2006-01-02 15:04:05"),
+				backup.BackedUpAt.Local().Format("2006-01-02 15:04:05"),
+				backup.SHA256)
+		}
+		return nil
+	},
+}
+
+var selfcheckCmd = &cobra.Command{
+	Use:    selfcheckCmdName,
+	Short:  "Report version of the app for the update health check",
+	Long:   ``,
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Version string `json:"version"`
+		}{Version: buildnumber})
+	},
+}
+
+// selfupdateError sets exit code of the app according to the kind of err.
+func selfupdateError(err error) error {
+	var rateErr *selfupdate.RateLimitError
+	var netErr *selfupdate.NetworkError
+	var healthErr *selfupdate.HealthCheckError
+	var signatureErr *selfupdate.SignatureError
+	var thresholdErr *selfupdate.ThresholdError
+	var metadataErr *selfupdate.MetadataError
+	var revokedErr *selfupdate.RevokedError
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &rateErr):
+		return &exitError{code: exitRateLimited, err: err}
+	case errors.Is(err, selfupdate.ErrNotFound):
+		return &exitError{code: exitNotFound, err: err}
+	case errors.As(err, &netErr):
+		return &exitError{code: exitNetwork, err: err}
+	case errors.As(err, &healthErr):
+		return &exitError{code: exitHealthCheck, err: err}
+	case errors.As(err, &signatureErr), errors.As(err, &thresholdErr):
+		return &exitError{code: exitSignature, err: err}
+	case errors.As(err, &metadataErr):
+		return &exitError{code: exitMetadata, err: err}
+	case errors.As(err, &revokedErr):
+		return &exitError{code: exitRevoked, err: err}
+	}
+
+	return err
+}
+
+// revocationReason returns the reason of the revocation for output.
+func revocationReason(revoked *selfupdate.Revocation) string {
+	if revoked.Reason == "" {
+		return "no reason given"
+	}
+	return revoked.Reason
+}
+
+// printVerification prints the keys that signed the binary, if verified.
+func printVerification(v *selfupdate.Verification) {
+	if v == nil {
+		return
+	}
+
+	fmt.Println("Signed by:", strings.Join(v.Signed, ", "))
+	if len(v.Missing) > 0 {
+		fmt.Println("Not signed by:", strings.Join(v.Missing, ", "))
+	}
+}
+
+// selfupdateConfig returns self-update configuration with command line
+// flags applied on top of it.
+func selfupdateConfig() (*selfupdate.Config, error) {
+	cfg, err := getConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &cfg.SelfUpdate
+	if selfupdateTokenFile != "" {
+		conf.Token = ""
+		conf.TokenFile = selfupdateTokenFile
+	}
+	if selfupdateChannel != "" {
+		conf.Channel = selfupdateChannel
+	}
+	if selfupdateVerify != "" {
+		conf.Verify = selfupdateVerify
+	}
+
+	return conf, nil
+}
+
+// selfupdateUpdater returns the updater of the app binary configured with
+// conf and opts.
+func selfupdateUpdater(conf *selfupdate.Config, opts ...selfupdate.Option) (*selfupdate.Updater, error) {
+	opts = append([]selfupdate.Option{
+		selfupdate.WithBinary(binary),
+		selfupdate.WithCurrentVersion(buildnumber),
+		selfupdate.WithChannel(conf.Channel),
+		selfupdate.WithBackupStore(conf.BackupStore()),
+		selfupdate.WithKeyringFile(conf.Keyring),
+		selfupdate.WithThreshold(conf.Threshold),
+		selfupdate.WithVerify(conf.Verify),
+		selfupdate.WithRequireMetadata(conf.RequireMetadata),
+	}, opts...)
+
+	return selfupdate.New(opts...)
+}
+
+// selfupdateSource returns the release source for the binary's repository.
+func selfupdateSource(conf *selfupdate.Config) (selfupdate.Source, error) {
+	if selfupdateFrom != "" {
+		src, err := selfupdate.NewFileSource(selfupdateFrom)
+		if err != nil {
+			return nil, err
+		}
+		return src, nil
+	}
+
+	if selfupdateManifest != "" {
+		src, err := selfupdate.NewManifestSource(selfupdateManifest)
+		if err != nil {
+			return nil, err
+		}
+		return src, nil
+	}
+
+	provider := selfupdateProvider
+	if provider == "" {
+		provider = selfupdate.DetectProvider(giturl)
+	}
+
+	switch provider {
+	case selfupdate.ProviderGitHub:
+		token, err := conf.AccessToken()
+		if err != nil {
+			return nil, err
+		}
+
+		src, err := selfupdate.NewGitHubSource(giturl)
+		if err != nil {
+			return nil, err
+		}
+		if selfupdateAPIURL != "" {
+			src.BaseURL = selfupdateAPIURL
+		}
+		src.Token = token
+		return src, nil
+	case selfupdate.ProviderGitLab:
+		src, err := selfupdate.NewGitLabSource(giturl)
+		if err != nil {
+			return nil, err
+		}
+		if selfupdateAPIURL != "" {
+			src.BaseURL = selfupdateAPIURL
+		}
+		return src, nil
+	}
+
+	return nil, fmt.Errorf("unknown release provider %q", provider)
+}
+
 func init() {
+	selfupdateCmd.PersistentFlags().StringVar(&selfupdateProvider, "provider", "", "release provider (github or gitlab), detected from the repository URL if not set")
+	selfupdateCmd.PersistentFlags().StringVar(&selfupdateAPIURL, "api-url", "", "release provider API base URL (e.g. https://ghe.corp/api/v3)")
+	selfupdateCmd.PersistentFlags().StringVar(&selfupdateTokenFile, "token-file", "", "file with GitHub access token (GH_TOKEN or GITHUB_TOKEN are used if not set)")
+	selfupdateCmd.PersistentFlags().StringVar(&selfupdateManifest, "manifest", "", "URL of a signed release manifest to use instead of the release provider")
+	selfupdateCmd.PersistentFlags().StringVar(&selfupdateFrom, "from", "", "local directory (or file:// URL) with release folders to update from")
+	selfupdateCheckCmd.Flags().StringVar(&selfupdateChannel, "channel", "", "release channel: stable, prerelease or tag prefix (e.g. v2.)")
+	selfupdateDownloadCmd.Flags().StringVar(&selfupdateChannel, "channel", "", "release channel: stable, prerelease or tag prefix (e.g. v2.)")
+	selfupdateDownloadCmd.Flags().BoolVar(&selfupdateDowngrade, "allow-downgrade", false, "allow to install older (or not comparable) version than the current one")
+	selfupdateDownloadCmd.Flags().StringVar(&selfupdateVersion, "version", "", "install the given release version (tag) instead of the latest one")
+	selfupdateDownloadCmd.Flags().StringVar(&selfupdateProgress, "progress", progressAuto, "progress output: auto (bar for terminal, plain otherwise), bar, plain or json")
+	selfupdateDownloadCmd.Flags().BoolVar(&selfupdateDryRun, "dry-run", false, "download and verify the update and report the planned steps without replacing the binary")
+	selfupdateDownloadCmd.Flags().BoolVar(&selfupdateNoCheck, "skip-health-check", false, "do not run the installed binary to check it (e.g. for versions without self-check)")
+	selfupdateDownloadCmd.Flags().StringVar(&selfupdateVerify, "verify", "", "verify policy of the downloaded binary: msign, checksum or both")
+	selfupdateRollbackCmd.Flags().StringVar(&selfupdateVersion, "version", "", "restore the retained backup with the given version instead of the last one")
 	selfupdateCmd.AddCommand(selfupdateCheckCmd)
 	selfupdateCmd.AddCommand(selfupdateDownloadCmd)
+	selfupdateCmd.AddCommand(selfupdateRollbackCmd)
+	selfupdateCmd.AddCommand(selfupdateHistoryCmd)
 	rootCmd.AddCommand(selfupdateCmd)
+	rootCmd.AddCommand(selfcheckCmd)
 }
@@ -0,0 +1,46 @@
+//go:build selfupdate
+// +build selfupdate
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"go.melnyk.org/selfupdate-test/internal/config"
+	"go.melnyk.org/selfupdate-test/internal/selfupdate"
+)
+
+const (
+	currentConfigVersion = 1
+)
+
+type appconfig struct {
+	SelfUpdate selfupdate.Config `yaml:"selfupdate"`
+}
+
+// getConfig returns app config, config file is optional for the cli app
+// (default values are used if it is not found).
+func getConfig() (*appconfig, error) {
+	cfg := &appconfig{}
+	cfg.SelfUpdate.Reset()
+
+	err := config.GetConfig(cfg, appshortname, currentConfigVersion)
+	if errors.Is(err, config.ErrConfigNotFound) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.check()
+}
+
+func (cfg *appconfig) check() error {
+	// Do config check here
+	if err := cfg.SelfUpdate.Validate(); err != nil {
+		return fmt.Errorf("config:selfupdate:%w", err)
+	}
+
+	return nil
+}
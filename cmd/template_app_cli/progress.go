@@ -0,0 +1,189 @@
+//go:build selfupdate
+// +build selfupdate
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.melnyk.org/selfupdate-test/internal/selfupdate"
+)
+
+// Progress output formats
+const (
+	progressAuto  = "auto"
+	progressBar   = "bar"
+	progressPlain = "plain"
+	progressJSON  = "json"
+
+	progressWidth    = 30
+	progressInterval = 100 * time.Millisecond
+)
+
+// selfupdateProgressFunc returns the progress observer for the format.
+// The progress bar is used for terminals in auto mode, plain lines
+// otherwise.
+func selfupdateProgressFunc(format string) (selfupdate.ProgressFunc, error) {
+	switch format {
+	case "", progressAuto:
+		if isTerminal(os.Stdout) {
+			return newBarProgress(os.Stdout), nil
+		}
+		return selfupdate.LineProgress(os.Stdout), nil
+	case progressBar:
+		return newBarProgress(os.Stdout), nil
+	case progressPlain:
+		return selfupdate.LineProgress(os.Stdout), nil
+	case progressJSON:
+		return newJSONProgress(os.Stdout), nil
+	}
+
+	return nil, fmt.Errorf("unknown progress format %q", format)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// newBarProgress returns the progress observer drawing a progress bar with
+// the rate and ETA of downloads, other phases are written as lines.
+func newBarProgress(w io.Writer) selfupdate.ProgressFunc {
+	line := selfupdate.LineProgress(w)
+
+	var started, drawn time.Time
+	var offset, received int64
+
+	return func(p selfupdate.Progress) {
+		if p.Phase != selfupdate.PhaseDownload || p.Total <= 0 {
+			line(p)
+			return
+		}
+
+		now := time.Now()
+		switch {
+		case !p.Done && p.Received == 0:
+			started, drawn, offset, received = now, time.Time{}, -1, 0
+			return
+		case !p.Done:
+			received = p.Received
+			if offset < 0 {
+				offset = p.Received // resumed part is not counted in the rate
+			}
+			if now.Sub(drawn) < progressInterval {
+				return
+			}
+			drawn = now
+		}
+
+		if p.Done && p.Err == nil {
+			received = p.Total
+		}
+
+		filled := int(received * progressWidth / p.Total)
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+		status := fmt.Sprintf("%3d%% %s/%s", received*100/p.Total, formatBytes(received), formatBytes(p.Total))
+
+		elapsed := now.Sub(started).Seconds()
+		switch {
+		case p.Done && p.Err != nil:
+			status += " failed\n"
+		case p.Done:
+			status += " done\n"
+		case elapsed > 0 && offset >= 0 && received > offset:
+			rate := float64(received-offset) / elapsed
+			eta := time.Duration(float64(p.Total-received)/rate) * time.Second
+			status += fmt.Sprintf(" %s/s ETA %s", formatBytes(int64(rate)), eta.Round(time.Second))
+		}
+
+		fmt.Fprintf(w, "\r\033[K%s [%s] %s", p.Title(), bar, status)
+	}
+}
+
+// jsonEvent is a progress event written with --progress=json.
+type jsonEvent struct {
+	Phase    selfupdate.Phase `json:"phase"`
+	Name     string           `json:"name,omitempty"`
+	Received int64            `json:"received"`
+	Total    int64            `json:"total"`
+	Done     bool             `json:"done"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// newJSONProgress returns the progress observer writing an event per line
+// as JSON. Download progress events are throttled.
+func newJSONProgress(w io.Writer) selfupdate.ProgressFunc {
+	enc := json.NewEncoder(w)
+	var last time.Time
+
+	return func(p selfupdate.Progress) {
+		if !p.Done && p.Received > 0 {
+			if time.Since(last) < progressInterval {
+				return
+			}
+			last = time.Now()
+		}
+
+		event := jsonEvent{Phase: p.Phase, Name: p.Name, Received: p.Received, Total: p.Total, Done: p.Done}
+		if p.Err != nil {
+			event.Error = p.Err.Error()
+		}
+		_ = enc.Encode(event)
+	}
+}
+
+// jsonResult is the result of the update written with --progress=json.
+type jsonResult struct {
+	Action    selfupdate.Action `json:"action"`
+	Status    selfupdate.Status `json:"status"`
+	Current   string            `json:"current"`
+	Candidate string            `json:"candidate"`
+	Target    string            `json:"target,omitempty"`
+	Plan      []string          `json:"plan,omitempty"`
+	Keyring   []string          `json:"keyring,omitempty"`
+	Signed    []string          `json:"signed,omitempty"`
+	Missing   []string          `json:"missing,omitempty"`
+}
+
+func writeJSONResult(w io.Writer, res *selfupdate.ApplyResult) error {
+	result := jsonResult{
+		Action:    res.Action,
+		Status:    res.Status,
+		Current:   res.Current,
+		Candidate: res.Candidate.TagName,
+		Target:    res.Target,
+	}
+	for _, step := range res.Plan {
+		result.Plan = append(result.Plan, step.String())
+	}
+	if res.Keyring != nil {
+		result.Keyring = res.Keyring.IDs()
+	}
+	if res.Verification != nil {
+		result.Signed = res.Verification.Signed
+		result.Missing = res.Verification.Missing
+	}
+
+	return json.NewEncoder(w).Encode(result)
+}
+
+// formatBytes returns n in human readable binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -20,7 +20,11 @@ const (
 )
 
 var (
-	errConfigNotFound     = errors.New("config not found")
+	// ErrConfigNotFound is returned if config file for the app is not found
+	ErrConfigNotFound = errors.New("config not found")
+)
+
+var (
 	errConfigNoConfigKind = errors.New("file is not config kind")
 	errConfigNoConfig     = errors.New("config section not found")
 	errConfigWrongApp     = errors.New("config is not for app")
@@ -69,7 +73,7 @@ func defaultConfigFile() (string, error) {
 		}
 	}
 
-	return cf, errConfigNotFound
+	return cf, ErrConfigNotFound
 }
 
 func defaultConfigDropDir(file string) (string, error) {
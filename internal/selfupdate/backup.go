@@ -0,0 +1,577 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBackupKeep is the default number of retained backups.
+	DefaultBackupKeep = 3
+
+	backupExt      = ".bak"
+	backupInfoExt  = ".json"
+	backupDirExt   = ".backups"
+	backupInfoName = "backup.json"
+	newExt         = ".new"
+)
+
+// Backup describes a binary replaced by an update (or a rollback).
+type Backup struct {
+	Version     string    `json:"version"`
+	InstalledAt time.Time `json:"installed_at"`
+	BackedUpAt  time.Time `json:"backed_up_at"`
+	SHA256      string    `json:"sha256"`
+	// Signature is msign signature of the binary, if known.
+	Signature string `json:"signature,omitempty"`
+	// Signatures are msign signatures of the binary by the key identifier.
+	Signatures map[string]string `json:"signatures,omitempty"`
+	File       string            `json:"file"`
+
+	// Path is the location of the backup binary.
+	Path string `json:"-"`
+}
+
+// BackupStore keeps the last binaries replaced by updates in a versioned
+// backup directory:
+//
+//	<dir>/<version>/<binary>
+//	<dir>/<version>/backup.json
+type BackupStore struct {
+	// Dir is the backup directory. If not set, .<binary>.backups next to
+	// the executable is used, or the user cache directory if the former
+	// is not writable.
+	Dir string
+
+	// Keep is the number of retained backups, DefaultBackupKeep if not set.
+	Keep int
+}
+
+// executablePath returns the path of the running binary with symlinks
+// resolved.
+func executablePath() (string, error) {
+	currentBinary, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return resolvePath(currentBinary), nil
+}
+
+// dir returns the backup directory for executable, creating it if needed.
+func (s *BackupStore) dir(executable string) (string, error) {
+	if s != nil && s.Dir != "" {
+		return s.Dir, os.MkdirAll(s.Dir, 0755)
+	}
+
+	dir := localBackupDir(executable)
+	if err := os.MkdirAll(dir, 0755); err == nil {
+		return dir, nil
+	}
+
+	dir, err := cacheBackupDir(executable)
+	if err != nil {
+		return "", err
+	}
+
+	return dir, os.MkdirAll(dir, 0755)
+}
+
+// locate returns the backup directory for executable like dir does, but
+// without creating it.
+func (s *BackupStore) locate(executable string) (string, error) {
+	if s != nil && s.Dir != "" {
+		return s.Dir, nil
+	}
+
+	dir := localBackupDir(executable)
+	if _, err := os.Stat(dir); err == nil || writable(filepath.Dir(executable)) == nil {
+		return dir, nil
+	}
+
+	return cacheBackupDir(executable)
+}
+
+// localBackupDir returns the backup directory next to executable.
+func localBackupDir(executable string) string {
+	return filepath.Join(filepath.Dir(executable), "."+filepath.Base(executable)+backupDirExt)
+}
+
+// cacheBackupDir returns the backup directory in the user cache directory.
+func cacheBackupDir(executable string) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cache, filepath.Base(executable), strings.TrimPrefix(backupDirExt, ".")), nil
+}
+
+func (s *BackupStore) keep() int {
+	if s != nil && s.Keep > 0 {
+		return s.Keep
+	}
+	return DefaultBackupKeep
+}
+
+// List returns retained backups of executable, most recent first. The store
+// is not created, there are no backups if it does not exist.
+func (s *BackupStore) List(executable string) ([]Backup, error) {
+	dir, err := s.locate(executable)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		cont, err := os.ReadFile(filepath.Join(dir, entry.Name(), backupInfoName))
+		if err != nil {
+			continue // not a backup
+		}
+
+		var backup Backup
+		if err = json.Unmarshal(cont, &backup); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		backup.Path = filepath.Join(dir, entry.Name(), filepath.Base(backup.File))
+		backups = append(backups, backup)
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].BackedUpAt.After(backups[j].BackedUpAt)
+	})
+
+	return backups, nil
+}
+
+// add moves binary into the store as a backup of executable, removes
+// the oldest backups above the limit and returns the stored backup.
+func (s *BackupStore) add(executable string, binary string, backup Backup) (Backup, error) {
+	dir, err := s.dir(executable)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	sum, err := fileSHA256(binary)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	backup.SHA256 = sum
+	backup.BackedUpAt = time.Now()
+	backup.File = filepath.Base(executable)
+
+	entry := backupEntry(dir, backup.Version)
+	if err = os.RemoveAll(entry); err != nil {
+		return Backup{}, err
+	}
+	if err = os.Mkdir(entry, 0755); err != nil {
+		return Backup{}, err
+	}
+
+	backup.Path = filepath.Join(entry, backup.File)
+	if err = moveFile(binary, backup.Path); err != nil {
+		os.RemoveAll(entry) // clean up
+		return Backup{}, err
+	}
+
+	cont, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return Backup{}, err
+	}
+
+	if err = os.WriteFile(filepath.Join(entry, backupInfoName), cont, 0644); err != nil {
+		return Backup{}, err
+	}
+
+	return backup, s.prune(executable)
+}
+
+// path returns the path of the backup binary of executable with
+// the given version. The store is not created.
+func (s *BackupStore) path(executable string, version string) (string, error) {
+	dir, err := s.locate(executable)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(backupEntry(dir, version), filepath.Base(executable)), nil
+}
+
+// backupEntry returns the directory of the backup with the given version.
+func backupEntry(dir string, version string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(version)
+	if name == "" || name == "." || name == ".." {
+		name = "unknown"
+	}
+
+	return filepath.Join(dir, name)
+}
+
+// remove deletes the backup from the store.
+func (s *BackupStore) remove(backup Backup) error {
+	return os.RemoveAll(filepath.Dir(backup.Path))
+}
+
+// prune removes the oldest backups above the limit.
+func (s *BackupStore) prune(executable string) error {
+	backups, err := s.List(executable)
+	if err != nil {
+		return err
+	}
+
+	for i := s.keep(); i < len(backups); i++ {
+		if err = s.remove(backups[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseSignatures downloads msign signatures of binary in the release with
+// the given tag, see signatureAssets. It is used to keep the signatures of
+// the replaced binary.
+func releaseSignatures(ctx context.Context, src Source, tag string, binary string, keyring *Keyring) (map[string][]byte, error) {
+	release, err := src.ReleaseByTag(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := signatureAssets(release.Assets, binary, keyring)
+	if len(assets) == 0 {
+		return nil, fmt.Errorf("binary sign asset %q %w", binary+signExt, ErrNotFound)
+	}
+
+	signs := make(map[string][]byte, len(assets))
+	for id, asset := range assets {
+		if signs[id], err = downloadAsset(ctx, src, asset); err != nil {
+			return nil, err
+		}
+	}
+
+	return signs, nil
+}
+
+// setSignatures keeps signs in the backup.
+func (b *Backup) setSignatures(signs map[string][]byte) {
+	for id, sign := range signs {
+		if id == "" {
+			b.Signature = string(sign)
+			continue
+		}
+
+		if b.Signatures == nil {
+			b.Signatures = map[string]string{}
+		}
+		b.Signatures[id] = string(sign)
+	}
+}
+
+// signatures returns the kept signatures of the backup.
+func (b *Backup) signatures() map[string][]byte {
+	signs := map[string][]byte{}
+	if b.Signature != "" {
+		signs[""] = []byte(b.Signature)
+	}
+	for id, sign := range b.Signatures {
+		signs[id] = []byte(sign)
+	}
+	return signs
+}
+
+// RollbackResult describes the restored backup.
+type RollbackResult struct {
+	Restored Backup
+	// Verified is set if msign signature of the restored binary is verified,
+	// it is not known for binaries installed without self-update.
+	Verified bool
+	// Verification reports the keys that signed the restored binary, nil
+	// if it is not verified.
+	Verification *Verification
+	// Target is the path of the restored binary.
+	Target string
+	// Backup is the replaced binary kept in the backup store.
+	Backup Backup
+}
+
+// History returns retained backups of the target binary, most recent first.
+func (u *Updater) History() ([]Backup, error) {
+	target, err := u.targetPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return u.store.List(target)
+}
+
+// Rollback restores the retained backup with the given version, or the most
+// recent one if version is empty. The binary left as <target>.bak is
+// restored if the store has no such backup. The backup is verified with its SHA-256
+// digest and msign signature, if known, and refused if it is in the
+// revocation list of the source. The current binary is kept as a backup,
+// so rollback could be reverted.
+func (u *Updater) Rollback(ctx context.Context, version string) (*RollbackResult, error) {
+	ctx, cancel := u.context(ctx)
+	defer cancel()
+
+	target, err := u.targetPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Find backup
+	backups, err := u.store.List(target)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RollbackResult{Target: target}
+	for _, b := range backups {
+		if version == "" || b.Version == version {
+			res.Restored = b
+			break
+		}
+	}
+
+	// The backup is left next to the target if it was not moved to the store
+	if res.Restored.Path == "" {
+		if left, ok := leftBackup(target); ok && (version == "" || left.Version == version) {
+			res.Restored = left
+		}
+	}
+
+	if res.Restored.Path == "" {
+		if version == "" {
+			return nil, fmt.Errorf("backups %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("backup %q %w", version, ErrNotFound)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// 2. Refuse revoked backup, the list is optional to keep rollback
+	// working offline
+	if u.source != nil {
+		revocations, err := u.revocations(ctx)
+		if err != nil {
+			u.log.Warning("Revocation list is not available: " + err.Error())
+		}
+		if err = revocations.revoked(res.Restored.Version, res.Restored.SHA256); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. Verify backup
+	done := u.progress.start(PhaseVerify, res.Restored.Version, 0)
+	res.Verification, err = verifyBackup(u.keyring, res.Restored)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Verified = res.Verification != nil
+	if !res.Verified {
+		u.log.Warning("Backup signature is not known, verification skipped")
+	}
+
+	// 4. Copy backup next to the target binary and swap them
+	done = u.progress.start(PhaseInstall, res.Restored.Version, 0)
+	info, err := os.Stat(target)
+	if err == nil {
+		err = copyFile(res.Restored.Path, target+newExt)
+		if err != nil {
+			os.Remove(target + newExt) // clean up
+		}
+	}
+	if err == nil {
+		err = replaceBinary(target, target+newExt)
+	}
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+
+	// 5. Keep the replaced binary as a backup
+	if res.Restored.Path == target+backupExt {
+		// The left backup is replaced by the current binary
+		os.Remove(target + backupExt + backupInfoExt)
+	} else {
+		err = u.store.remove(res.Restored)
+	}
+	if err == nil {
+		res.Backup, err = u.store.add(target, target+backupExt, Backup{
+			Version:     u.current,
+			InstalledAt: info.ModTime(),
+		})
+	}
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Restored version: " + res.Restored.Version)
+
+	return res, nil
+}
+
+// leftBackup returns the backup left as <executable>.bak, e.g. if it failed
+// to move to the store or it is made by a version without the store. Its
+// version and signatures are read from <executable>.bak.json, if any.
+func leftBackup(executable string) (Backup, bool) {
+	path := executable + backupExt
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return Backup{}, false
+	}
+
+	var backup Backup
+	if cont, err := os.ReadFile(path + backupInfoExt); err == nil {
+		if err = json.Unmarshal(cont, &backup); err != nil {
+			backup = Backup{}
+		}
+	}
+
+	backup.SHA256 = sum
+	backup.File = filepath.Base(executable)
+	backup.Path = path
+	return backup, true
+}
+
+// keepLeftBackup writes the version and signatures of the backup left as
+// <executable>.bak for rollback.
+func keepLeftBackup(executable string, backup Backup) error {
+	cont, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(executable+backupExt+backupInfoExt, cont, 0644)
+}
+
+// verifyBackup checks SHA-256 digest and msign signatures, if known,
+// of the backup. The backup is verified by the threshold when installed,
+// so a signature of any trusted key is enough, e.g. for releases signed
+// before the threshold is raised.
+func verifyBackup(keyring *Keyring, backup Backup) (*Verification, error) {
+	sum, err := fileSHA256(backup.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if sum != backup.SHA256 {
+		return nil, errors.New("backup SHA-256 digest mismatch")
+	}
+
+	signs := backup.signatures()
+	if len(signs) == 0 {
+		return nil, nil
+	}
+
+	return verifySignaturesFile(keyring, 1, backup.Path, signs)
+}
+
+// replaceBinary replaces currentBinary with newBinary, the replaced binary
+// is left as <currentBinary>.bak.
+func replaceBinary(currentBinary string, newBinary string) error {
+	// Rename old binary to backup name
+	err := os.Rename(currentBinary, currentBinary+backupExt)
+	if err != nil {
+		os.Remove(newBinary) // clean up
+		return err
+	}
+
+	// Rename new binary to old binary name
+	err = os.Rename(newBinary, currentBinary)
+	if err != nil {
+		os.Rename(currentBinary+backupExt, currentBinary) // revert backup
+		return err
+	}
+
+	return nil
+}
+
+// moveFile renames src to dst, falling back to copying for different
+// file systems.
+func moveFile(src string, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst) // clean up
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// copyFile copies src to dst with the same permissions.
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(dst, info.Mode())
+}
+
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
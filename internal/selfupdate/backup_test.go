@@ -0,0 +1,74 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupStore(t *testing.T) {
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "app")
+	store := &BackupStore{Dir: filepath.Join(dir, "backups"), Keep: 2}
+
+	for _, version := range []string{"v1.0.0", "v1.1.0", "release/v1.2.0"} {
+		binary := executable + backupExt
+		if err := os.WriteFile(binary, []byte(version), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.add(executable, binary, Backup{Version: version}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", version, err)
+		}
+		if _, err := os.Stat(binary); !os.IsNotExist(err) {
+			t.Errorf("%s: binary is not moved to the store", version)
+		}
+	}
+
+	backups, err := store.List(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 retained backups, got %d", len(backups))
+	}
+	if backups[0].Version != "release/v1.2.0" || backups[1].Version != "v1.1.0" {
+		t.Errorf("unexpected backups order: %q, %q", backups[0].Version, backups[1].Version)
+	}
+
+	sum, err := fileSHA256(backups[1].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != backups[1].SHA256 {
+		t.Errorf("unexpected digest %q, expected %q", backups[1].SHA256, sum)
+	}
+	if info, err := os.Stat(backups[1].Path); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("unexpected backup binary: %v, %v", info, err)
+	}
+
+	if err = store.remove(backups[0]); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ = store.List(executable); len(backups) != 1 || backups[0].Version != "v1.1.0" {
+		t.Errorf("unexpected backups after remove: %v", backups)
+	}
+}
+
+func TestBackupStoreListMissing(t *testing.T) {
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "app")
+
+	// The default store next to the executable is not created by listing
+	var store *BackupStore
+	backups, err := store.List(executable)
+	if err != nil || len(backups) != 0 {
+		t.Fatalf("unexpected backups %v, %v", backups, err)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, ".app"+backupDirExt)); !os.IsNotExist(err) {
+		t.Errorf("backup store is created by the listing: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Release channels. Any other channel name is a tag prefix (e.g. "v2."),
+// which pins updates to stable releases with matching tags.
+const (
+	ChannelStable     = "stable"
+	ChannelPrerelease = "prerelease"
+)
+
+// inChannel reports whether release belongs to channel. Drafts never do.
+func inChannel(release Release, channel string) bool {
+	if release.Draft {
+		return false
+	}
+
+	switch channel {
+	case "", ChannelStable:
+		return !release.PreRelease
+	case ChannelPrerelease:
+		return true
+	}
+
+	return !release.PreRelease && strings.HasPrefix(release.TagName, channel)
+}
+
+// newerRelease reports whether a is newer than b. Semantic versions of
+// the tags are compared if possible, publishing time otherwise.
+func newerRelease(a, b Release) bool {
+	if c, ok := compareVersions(a.TagName, b.TagName); ok {
+		return c > 0
+	}
+	return a.PublishedAt.After(b.PublishedAt)
+}
+
+// latestRelease returns the newest release of src in channel.
+func latestRelease(ctx context.Context, src Source, channel string) (Release, error) {
+	if channel == "" || channel == ChannelStable {
+		return src.LatestRelease(ctx)
+	}
+
+	releases, err := src.ListReleases(ctx)
+	if err != nil {
+		return Release{}, err
+	}
+
+	latest, ok := newestRelease(releases, channel)
+	if !ok {
+		return Release{}, fmt.Errorf("releases in channel %q %w", channel, ErrNotFound)
+	}
+
+	return latest, nil
+}
+
+// newestRelease returns the newest of releases in channel, false if there
+// is none.
+func newestRelease(releases []Release, channel string) (Release, bool) {
+	var latest Release
+	found := false
+	for _, release := range releases {
+		if !inChannel(release, channel) {
+			continue
+		}
+		if !found || newerRelease(release, latest) {
+			latest = release
+			found = true
+		}
+	}
+
+	return latest, found
+}
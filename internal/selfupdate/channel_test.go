@@ -0,0 +1,48 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLatestRelease(t *testing.T) {
+	now := time.Now()
+	src := &memSource{releases: []Release{
+		{TagName: "v3.0.0", Draft: true, PublishedAt: now},
+		{TagName: "v2.1.0-rc.1", PreRelease: true, PublishedAt: now.Add(-1 * time.Hour)},
+		{TagName: "v1.9.1", PublishedAt: now.Add(-2 * time.Hour)},
+		{TagName: "v2.0.0", PublishedAt: now.Add(-3 * time.Hour)},
+		{TagName: "v1.9.0", PublishedAt: now.Add(-4 * time.Hour)},
+	}}
+
+	tests := []struct {
+		channel string
+		tag     string
+	}{
+		{"", "v1.9.1"},
+		{ChannelStable, "v1.9.1"},
+		{ChannelPrerelease, "v2.1.0-rc.1"},
+		{"v2.", "v2.0.0"},
+		{"v1.9.0", "v1.9.0"},
+	}
+
+	for _, test := range tests {
+		release, err := latestRelease(context.Background(), src, test.channel)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.channel, err)
+			continue
+		}
+		if release.TagName != test.tag {
+			t.Errorf("%q: got %q, expected %q", test.channel, release.TagName, test.tag)
+		}
+	}
+
+	if _, err := latestRelease(context.Background(), src, "v3."); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error for draft-only channel, got %v", err)
+	}
+}
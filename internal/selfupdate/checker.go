@@ -0,0 +1,154 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Update policies of the checker.
+const (
+	// PolicyNotify only reports the available update.
+	PolicyNotify = "notify"
+	// PolicyApply installs the available update.
+	PolicyApply = "apply"
+)
+
+const (
+	// DefaultCheckInterval is the default interval between update checks.
+	DefaultCheckInterval = 24 * time.Hour
+	// minCheckBackoff is the first delay of the check retry after error.
+	minCheckBackoff = time.Minute
+)
+
+// Checker periodically checks for the updates in the background and reports
+// or applies them according to the policy.
+type Checker struct {
+	Updater *Updater
+	// Interval between checks, DefaultCheckInterval if not set.
+	Interval time.Duration
+	// Jitter is the upper limit of the random delay added to the interval,
+	// a tenth of the interval if not set.
+	Jitter time.Duration
+	// Policy is PolicyNotify (default) or PolicyApply.
+	Policy string
+	// Report, if set, is called with the result of every check. The action
+	// is ActionNone for PolicyNotify, Update tells if the update is
+	// available then.
+	Report func(res *ApplyResult, err error)
+}
+
+// Run checks for the updates until ctx is done. The first check is made
+// after the random jitter delay, the failed checks are retried with the
+// exponential backoff limited by the interval.
+func (c *Checker) Run(ctx context.Context) error {
+	if c.Updater == nil {
+		return errors.New("updater is not set")
+	}
+
+	switch c.Policy {
+	case "", PolicyNotify, PolicyApply:
+	default:
+		return errors.New("unknown update policy " + c.Policy)
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	delay := c.jitter(random)
+	backoff := time.Duration(0)
+
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		err := c.check(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err == nil {
+			backoff = 0
+			delay = c.interval() + c.jitter(random)
+			continue
+		}
+
+		backoff = c.backoff(backoff)
+		delay = backoff
+		var rateErr *RateLimitError
+		if errors.As(err, &rateErr) && !rateErr.Reset.IsZero() {
+			if wait := time.Until(rateErr.Reset); wait > delay {
+				delay = wait
+			}
+		}
+		c.Updater.log.Warning("Update check failed, retry in " + delay.Round(time.Second).String() + ": " + err.Error())
+	}
+}
+
+// check runs a single check and reports its result.
+func (c *Checker) check(ctx context.Context) error {
+	var res *ApplyResult
+	var err error
+
+	if c.Policy == PolicyApply {
+		res, err = c.Updater.Apply(ctx)
+		if err == nil && res.Action == ActionUpdated {
+			// The installed binary is the current version for next checks
+			c.Updater.current = res.Candidate.TagName
+		}
+	} else {
+		var check *CheckResult
+		if check, err = c.Updater.Check(ctx); err == nil {
+			res = &ApplyResult{CheckResult: *check, Action: ActionNone}
+			if res.Update {
+				c.Updater.log.Info("Update is available: " + res.Candidate.TagName)
+			}
+		}
+	}
+
+	if err == nil && res.CurrentRevoked != nil {
+		c.Updater.log.Warning((&RevokedError{Version: res.Current, Reason: res.CurrentRevoked.Reason}).Error())
+	}
+
+	if c.Report != nil {
+		c.Report(res, err)
+	}
+
+	return err
+}
+
+// interval returns the interval between checks.
+func (c *Checker) interval() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultCheckInterval
+	}
+	return c.Interval
+}
+
+// jitter returns the random delay limited by the jitter.
+func (c *Checker) jitter(random *rand.Rand) time.Duration {
+	jitter := c.Jitter
+	if jitter <= 0 {
+		jitter = c.interval() / 10
+	}
+	return time.Duration(random.Int63n(int64(jitter) + 1))
+}
+
+// backoff returns the next delay after the failed check.
+func (c *Checker) backoff(prev time.Duration) time.Duration {
+	next := prev * 2
+	if next < minCheckBackoff {
+		next = minCheckBackoff
+	}
+	if next > c.interval() {
+		next = c.interval()
+	}
+	return next
+}
@@ -0,0 +1,61 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckerRun(t *testing.T) {
+	tests := []struct {
+		releases []Release
+		update   bool
+		failed   bool
+	}{
+		{[]Release{{TagName: "v1.2.0"}}, true, false},
+		{[]Release{{TagName: "v1.1.0"}}, false, false},
+		{nil, false, true},
+	}
+
+	for _, test := range tests {
+		u, err := New(WithSource(&memSource{releases: test.releases}), WithBinary("app"), WithCurrentVersion("v1.1.0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		reports := 0
+		checker := &Checker{
+			Updater:  u,
+			Interval: 10 * time.Millisecond,
+			Jitter:   time.Millisecond,
+			Report: func(res *ApplyResult, err error) {
+				if failed := err != nil; failed != test.failed {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if err == nil && (res.Action != ActionNone || res.Update != test.update) {
+					t.Errorf("unexpected result %+v", res)
+				}
+				if reports++; reports == 3 {
+					cancel()
+				}
+			},
+		}
+
+		if err = checker.Run(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected cancelled run, got %v", err)
+		}
+		if reports != 3 {
+			t.Errorf("expected 3 reports, got %d", reports)
+		}
+		cancel()
+	}
+
+	if err := (&Checker{Updater: &Updater{}, Policy: "never"}).Run(context.Background()); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
@@ -0,0 +1,102 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Verify policies of the downloaded binary.
+const (
+	// VerifyMsign requires msign signatures of the binary.
+	VerifyMsign = "msign"
+	// VerifyChecksum requires the binary digest in the signed checksums file.
+	VerifyChecksum = "checksum"
+	// VerifyBoth requires both msign signatures and the checksum.
+	VerifyBoth = "both"
+)
+
+const (
+	// checksumsAsset is the release asset with SHA-256 digests of the other
+	// assets, GoReleaser names it <project>_<version>_checksums.txt.
+	checksumsAsset = "checksums.txt"
+)
+
+// isChecksums reports whether asset is the checksums file.
+func isChecksums(asset Asset) bool {
+	return asset.Name == checksumsAsset || strings.HasSuffix(asset.Name, "_"+checksumsAsset)
+}
+
+// parseChecksums parses sha256sum style lines "<digest>  <name>" and returns
+// hex encoded digests by the asset name.
+func parseChecksums(data []byte) (map[string]string, error) {
+	sums := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("checksums: invalid line %d", line)
+		}
+
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != 32 {
+			return nil, fmt.Errorf("checksums: invalid SHA-256 digest at line %d", line)
+		}
+
+		// Binary mode of sha256sum marks the name with asterisk
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("checksums: %w", err)
+	}
+
+	return sums, nil
+}
+
+// releaseChecksum downloads the checksums asset of the release, verifies its
+// signatures and returns SHA-256 digest of binary.
+func (u *Updater) releaseChecksum(ctx context.Context, release Release, checksums Asset, binary string) (string, *Verification, error) {
+	signs, err := u.downloadSignatures(ctx, signatureAssets(release.Assets, checksums.Name, u.keyring))
+	if err != nil {
+		return "", nil, fmt.Errorf("checksums: %w", err)
+	}
+
+	done := u.progress.start(PhaseDownload, checksums.Name, checksums.Size)
+	data, err := downloadAsset(ctx, u.source, checksums)
+	done(err)
+	if err != nil {
+		return "", nil, fmt.Errorf("checksums: %w", err)
+	}
+
+	done = u.progress.start(PhaseVerify, checksums.Name, 0)
+	verification, err := verifySignaturesData(u.keyring, u.threshold(), data, signs)
+	done(err)
+	if err != nil {
+		return "", nil, fmt.Errorf("checksums: %w", err)
+	}
+
+	sums, err := parseChecksums(data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sum, ok := sums[binary]
+	if !ok {
+		return "", nil, fmt.Errorf("checksum of %q %w", binary, ErrNotFound)
+	}
+
+	return sum, verification, nil
+}
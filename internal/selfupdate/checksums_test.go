@@ -0,0 +1,32 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChecksums(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	data := sum + "  app\n" + strings.ToUpper(sum) + " *app.exe\n\n"
+
+	sums, err := parseChecksums([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 2 || sums["app"] != sum || sums["app.exe"] != sum {
+		t.Errorf("unexpected checksums %v", sums)
+	}
+
+	for _, data := range []string{"app\n", "abcd  app\n", sum + "  app extra\n"} {
+		if _, err = parseChecksums([]byte(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+
+	if !isChecksums(Asset{Name: "project_1.2.0_checksums.txt"}) || isChecksums(Asset{Name: "checksums.txt.msign"}) {
+		t.Error("unexpected checksums asset detection")
+	}
+}
@@ -0,0 +1,156 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// tokenEnvs lists environment variables with GitHub access token,
+	// in order of precedence.
+	tokenEnvs = []string{"GH_TOKEN", "GITHUB_TOKEN"}
+)
+
+// Config is self-update configuration structure
+type Config struct {
+	Channel   string `yaml:"channel"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token-file"`
+	// BackupDir is the directory for backups of replaced binaries,
+	// next to the executable if not set.
+	BackupDir  string `yaml:"backup-dir"`
+	BackupKeep int    `yaml:"backup-keep"`
+	// HealthCheck enables run of the installed binary, the replaced one
+	// is restored if it fails.
+	HealthCheck bool `yaml:"health-check"`
+	// HealthCheckSince is the first version supporting the health check,
+	// older versions are installed without it.
+	HealthCheckSince string `yaml:"health-check-since"`
+	// Keyring is the file with trusted public keys, next to the executable
+	// if not set.
+	Keyring string `yaml:"keyring"`
+	// Threshold is the minimal number of trusted keys required to sign
+	// a release, the keyring threshold is used if it is higher.
+	Threshold int `yaml:"threshold"`
+	// Verify is the verify policy of the downloaded binary: msign,
+	// checksum or both.
+	Verify string `yaml:"verify"`
+	// RequireMetadata rejects releases without signed release metadata,
+	// they are always rejected if the signature threshold is higher than 1.
+	RequireMetadata bool `yaml:"require-metadata"`
+	// CheckInterval and CheckPolicy configure the background checker
+	// of long-running processes.
+	CheckInterval time.Duration `yaml:"check-interval"`
+	CheckPolicy   string        `yaml:"check-policy"`
+}
+
+// Validate provides config structure validation
+func (conf *Config) Validate() error {
+	if strings.TrimSpace(conf.Channel) == "" {
+		return errors.New("Config parameter selfupdate.channel is not set to correct value")
+	}
+
+	if conf.TokenFile != "" {
+		if _, err := os.Stat(conf.TokenFile); err != nil {
+			return fmt.Errorf("token-file: %w", err)
+		}
+	}
+
+	if conf.BackupKeep < 1 {
+		return errors.New("Config parameter selfupdate.backup-keep should be positive")
+	}
+
+	if conf.HealthCheckSince != "" {
+		if _, err := ParseVersion(conf.HealthCheckSince); err != nil {
+			return fmt.Errorf("Config parameter selfupdate.health-check-since: %w", err)
+		}
+	}
+
+	if conf.Threshold < 0 {
+		return errors.New("Config parameter selfupdate.threshold should not be negative")
+	}
+
+	switch conf.Verify {
+	case VerifyMsign, VerifyChecksum, VerifyBoth:
+	default:
+		return errors.New("Config parameter selfupdate.verify is not set to correct value")
+	}
+
+	if conf.CheckInterval < 0 {
+		return errors.New("Config parameter selfupdate.check-interval should not be negative")
+	}
+
+	switch conf.CheckPolicy {
+	case PolicyNotify, PolicyApply:
+	default:
+		return errors.New("Config parameter selfupdate.check-policy is not set to correct value")
+	}
+
+	// All checks passed
+	return nil
+}
+
+// Reset fills config structure with default values
+func (conf *Config) Reset() {
+	conf.Cleanup()
+	conf.Channel = ChannelStable
+	conf.Token = ""
+	conf.TokenFile = ""
+	conf.BackupDir = ""
+	conf.BackupKeep = DefaultBackupKeep
+	conf.HealthCheck = true
+	conf.HealthCheckSince = ""
+	conf.Keyring = ""
+	conf.Threshold = 0
+	conf.Verify = VerifyMsign
+	conf.RequireMetadata = false
+	conf.CheckInterval = DefaultCheckInterval
+	conf.CheckPolicy = PolicyNotify
+}
+
+// Cleanup releases all allocated objects
+func (conf *Config) Cleanup() {
+	// Do nothing here
+}
+
+// AccessToken returns the token for release provider API requests. The
+// token is taken from the config value, the token file or the GH_TOKEN and
+// GITHUB_TOKEN environment variables, in this order. Empty token means
+// anonymous access.
+func (conf *Config) AccessToken() (string, error) {
+	if conf.Token != "" {
+		return conf.Token, nil
+	}
+
+	if conf.TokenFile != "" {
+		cont, err := os.ReadFile(conf.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("token-file: %w", err)
+		}
+		return strings.TrimSpace(string(cont)), nil
+	}
+
+	for _, env := range tokenEnvs {
+		if token := os.Getenv(env); token != "" {
+			return token, nil
+		}
+	}
+
+	return "", nil
+}
+
+// BackupStore returns the store for backups of replaced binaries.
+func (conf *Config) BackupStore() *BackupStore {
+	return &BackupStore{Dir: conf.BackupDir, Keep: conf.BackupKeep}
+}
+
+// Checker returns the background checker of updates with u.
+func (conf *Config) Checker(u *Updater) *Checker {
+	return &Checker{Updater: u, Interval: conf.CheckInterval, Policy: conf.CheckPolicy}
+}
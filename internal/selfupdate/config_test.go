@@ -0,0 +1,48 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigAccessToken(t *testing.T) {
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "")
+
+	conf := &Config{}
+	conf.Reset()
+
+	if token, err := conf.AccessToken(); err != nil || token != "" {
+		t.Fatalf("expected anonymous access, got %q, %v", token, err)
+	}
+
+	t.Setenv("GITHUB_TOKEN", "github-token")
+	if token, _ := conf.AccessToken(); token != "github-token" {
+		t.Errorf("unexpected token %q", token)
+	}
+
+	t.Setenv("GH_TOKEN", "gh-token")
+	if token, _ := conf.AccessToken(); token != "gh-token" {
+		t.Errorf("unexpected token %q", token)
+	}
+
+	conf.TokenFile = filepath.Join(t.TempDir(), "token")
+	if err := conf.Validate(); err == nil {
+		t.Error("expected validation error for missing token file")
+	}
+	if err := os.WriteFile(conf.TokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := conf.AccessToken(); token != "file-token" {
+		t.Errorf("unexpected token %q", token)
+	}
+
+	conf.Token = "config-token"
+	if token, _ := conf.AccessToken(); token != "config-token" {
+		t.Errorf("unexpected token %q", token)
+	}
+}
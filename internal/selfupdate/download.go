@@ -0,0 +1,219 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// maxAssetSize is the download limit for assets of unknown size.
+	maxAssetSize = 512 << 20
+
+	downloadStateExt = ".download"
+)
+
+// downloadState is kept next to partially downloaded file to resume
+// the download.
+type downloadState struct {
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+	ETag string `json:"etag"`
+}
+
+// downloadAsset reads the whole content of the asset from the source and
+// checks its size and digest, if known. It is intended for small assets
+// like signatures, use downloadAssetFile for binaries.
+func downloadAsset(ctx context.Context, src Source, asset Asset) ([]byte, error) {
+	rc, err := src.OpenAsset(ctx, asset)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	h := sha256.New()
+	limit := assetLimit(asset)
+
+	n, err := io.Copy(io.MultiWriter(&buf, h), io.LimitReader(rc, limit+1))
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+
+	err = rc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkAsset(asset, n, h); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// downloadAssetFile streams the content of the asset from the source to
+// file with the given permissions, hashing it on the fly, and checks its
+// size and digest, if known. If the source is a RangeSource, interrupted
+// download is kept in file and resumed on the next call. Otherwise the file
+// is removed on error. Received bytes are reported to progress.
+func downloadAssetFile(ctx context.Context, src Source, asset Asset, file string, perm os.FileMode, progress ProgressFunc) error {
+	var body AssetRange
+	var err error
+
+	if rs, ok := src.(RangeSource); ok {
+		offset, etag := partialDownload(file, asset)
+		body, err = rs.OpenAssetRange(ctx, asset, offset, etag)
+	} else {
+		body.Body, err = src.OpenAsset(ctx, asset)
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Body.Close()
+
+	flags := os.O_RDWR | os.O_CREATE
+	if body.Offset == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(file, flags, perm)
+	if err != nil {
+		return err
+	}
+
+	// Hash already downloaded part of the file
+	h := sha256.New()
+	if body.Offset > 0 {
+		if _, err = io.CopyN(h, f, body.Offset); err != nil {
+			f.Close()
+			removeDownload(file)
+			return err
+		}
+	}
+
+	if body.ETag != "" {
+		err = writeDownloadState(file, downloadState{URL: asset.URL, Size: asset.Size, ETag: body.ETag})
+	} else {
+		err = removeDownloadState(file)
+	}
+	if err != nil {
+		f.Close()
+		removeDownload(file)
+		return err
+	}
+
+	pw := &progressWriter{
+		report: progress,
+		p:      Progress{Phase: PhaseDownload, Name: asset.Name, Received: body.Offset, Total: asset.Size},
+	}
+
+	limit := assetLimit(asset) - body.Offset
+	n, err := io.Copy(io.MultiWriter(f, h, pw), io.LimitReader(body.Body, limit+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if body.ETag == "" {
+			removeDownload(file)
+		}
+		return err
+	}
+
+	if err = checkAsset(asset, body.Offset+n, h); err != nil {
+		removeDownload(file)
+		return err
+	}
+
+	if err = os.Chmod(file, perm); err != nil { // umask is applied on create
+		removeDownload(file)
+		return err
+	}
+
+	return removeDownloadState(file)
+}
+
+// partialDownload returns the size of partially downloaded file and ETag
+// of the asset content to resume the download, if it is possible.
+func partialDownload(file string, asset Asset) (int64, string) {
+	cont, err := os.ReadFile(file + downloadStateExt)
+	if err != nil {
+		return 0, ""
+	}
+
+	var state downloadState
+	if err = json.Unmarshal(cont, &state); err != nil {
+		return 0, ""
+	}
+
+	if state.URL != asset.URL || state.Size != asset.Size || state.ETag == "" {
+		return 0, ""
+	}
+
+	info, err := os.Stat(file)
+	if err != nil || info.Size() == 0 || (asset.Size > 0 && info.Size() >= asset.Size) {
+		return 0, ""
+	}
+
+	return info.Size(), state.ETag
+}
+
+func writeDownloadState(file string, state downloadState) error {
+	cont, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file+downloadStateExt, cont, 0644)
+}
+
+func removeDownloadState(file string) error {
+	err := os.Remove(file + downloadStateExt)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// removeDownload removes the downloaded file and its state.
+func removeDownload(file string) {
+	os.Remove(file)
+	os.Remove(file + downloadStateExt)
+}
+
+// assetLimit returns the upper bound of the asset content size.
+func assetLimit(asset Asset) int64 {
+	if asset.Size > 0 {
+		return asset.Size
+	}
+	return maxAssetSize
+}
+
+// checkAsset checks size n and digest h of the downloaded asset content.
+func checkAsset(asset Asset, n int64, h hash.Hash) error {
+	if limit := assetLimit(asset); n > limit {
+		return fmt.Errorf("asset %q: size exceeds %d bytes", asset.Name, limit)
+	}
+
+	if asset.Size > 0 && n != asset.Size {
+		return fmt.Errorf("asset %q: size mismatch, expected %d, got %d", asset.Name, asset.Size, n)
+	}
+
+	if asset.SHA256 != "" {
+		if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), asset.SHA256) {
+			return fmt.Errorf("asset %q: SHA-256 digest mismatch", asset.Name)
+		}
+	}
+
+	return nil
+}
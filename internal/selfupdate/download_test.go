@@ -0,0 +1,113 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newFlakyServer returns a server dropping the connection in the middle of
+// the first full response body. Ranges are served if ranges is set.
+func newFlakyServer(t *testing.T, data []byte, etag string, ranges bool) (*httptest.Server, *[]string) {
+	var requests []string
+	dropped := false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+
+		if !dropped {
+			dropped = true
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Write(data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+
+		if !ranges {
+			w.Write(data)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func TestDownloadAssetFileResume(t *testing.T) {
+	data := bytes.Repeat([]byte("binary content "), 1000)
+
+	tests := []struct {
+		name   string
+		ranges bool
+	}{
+		{"ranges", true},
+		{"no ranges", false},
+	}
+
+	for _, test := range tests {
+		srv, requests := newFlakyServer(t, data, `"v1"`, test.ranges)
+		src := &ManifestSource{Client: srv.Client()}
+		asset := Asset{Name: "app", URL: srv.URL + "/app", Size: int64(len(data))}
+		file := filepath.Join(t.TempDir(), "app.new")
+
+		if err := downloadAssetFile(context.Background(), src, asset, file, 0755, nil); err == nil {
+			t.Fatalf("%s: expected error for dropped connection", test.name)
+		}
+		if info, err := os.Stat(file); err != nil || info.Size() != int64(len(data)/2) {
+			t.Fatalf("%s: partial download is not kept: %v, %v", test.name, info, err)
+		}
+
+		if err := downloadAssetFile(context.Background(), src, asset, file, 0755, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if cont, _ := os.ReadFile(file); !bytes.Equal(cont, data) {
+			t.Errorf("%s: unexpected content of %d bytes", test.name, len(cont))
+		}
+		if _, err := os.Stat(file + downloadStateExt); !os.IsNotExist(err) {
+			t.Errorf("%s: download state is not removed", test.name)
+		}
+
+		if len(*requests) != 2 || (*requests)[1] != "bytes="+strconv.Itoa(len(data)/2)+"-" {
+			t.Errorf("%s: unexpected requests %q", test.name, *requests)
+		}
+	}
+}
+
+func TestDownloadAssetFileChanged(t *testing.T) {
+	data := bytes.Repeat([]byte("binary content "), 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	src := &ManifestSource{Client: srv.Client()}
+	asset := Asset{Name: "app", URL: srv.URL + "/app", Size: int64(len(data))}
+	file := filepath.Join(t.TempDir(), "app.new")
+
+	// Partial download of the previous asset content
+	if err := os.WriteFile(file, []byte("stale content"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDownloadState(file, downloadState{URL: asset.URL, Size: asset.Size, ETag: `"v1"`}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloadAssetFile(context.Background(), src, asset, file, 0755, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cont, _ := os.ReadFile(file); !bytes.Equal(cont, data) {
+		t.Errorf("unexpected content of %d bytes", len(cont))
+	}
+}
@@ -0,0 +1,192 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned if the repository, release or asset
+	// does not exist (or is not accessible with the used credentials).
+	ErrNotFound = errors.New("not found")
+)
+
+// StatusError is returned for unexpected HTTP status of an API or
+// asset request.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("unexpected status %v (%v) returned, message:\n  %v", e.StatusCode, e.Status, e.Message)
+	}
+	return fmt.Sprintf("unexpected status %v (%v) returned", e.StatusCode, e.Status)
+}
+
+// Is reports 404 responses as ErrNotFound.
+func (e *StatusError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// RateLimitError is returned when the API rate limit is exceeded.
+type RateLimitError struct {
+	StatusError
+
+	// Reset is the time when it is safe to retry, zero if unknown.
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	msg := "API rate limit exceeded"
+	if !e.Reset.IsZero() {
+		msg += ", retry after " + e.Reset.Local().Format("2006-01-02 15:04:05")
+	}
+	return msg + ": " + e.StatusError.Error()
+}
+
+// NetworkError is returned when the server can not be reached
+// (DNS failure, connection refused, etc).
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return "network error: " + e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// HealthCheckError is returned when the installed binary fails the health
+// check. The replaced binary is restored then.
+type HealthCheckError struct {
+	Version string
+	// Output is the error output of the binary, if any.
+	Output string
+	Err    error
+}
+
+func (e *HealthCheckError) Error() string {
+	msg := fmt.Sprintf("health check of %v failed: %v", e.Version, e.Err)
+	if e.Output != "" {
+		msg += ", output:\n  " + e.Output
+	}
+	return msg
+}
+
+func (e *HealthCheckError) Unwrap() error {
+	return e.Err
+}
+
+// SignatureError is returned when msign signature is malformed, invalid
+// or is not made by a trusted key.
+type SignatureError struct {
+	// Key is the identifier of the trusted key, empty if the signature
+	// is checked with any key.
+	Key string
+	// Err is the cause, nil if the signature does not match.
+	Err error
+}
+
+func (e *SignatureError) Error() string {
+	msg := "signature verification failed"
+	if e.Key != "" {
+		msg = fmt.Sprintf("signature of key %q verification failed", e.Key)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// ThresholdError is returned when the release is not signed by the
+// required number of trusted keys.
+type ThresholdError struct {
+	Verification
+}
+
+func (e *ThresholdError) Error() string {
+	msg := fmt.Sprintf("signed by %d of %d required keys", len(e.Signed), e.Threshold)
+	if len(e.Signed) > 0 {
+		msg += ", signed: " + strings.Join(e.Signed, ", ")
+	}
+	if len(e.Missing) > 0 {
+		msg += ", missing: " + strings.Join(e.Missing, ", ")
+	}
+	return msg
+}
+
+// MetadataError is returned when the signed release metadata is rejected,
+// e.g. it is expired or older than the installed version.
+type MetadataError struct {
+	Version string
+	Err     error
+}
+
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("release metadata of %v rejected: %v", e.Version, e.Err)
+}
+
+func (e *MetadataError) Unwrap() error {
+	return e.Err
+}
+
+// RevokedError is returned when the release (or binary) to install is in
+// the revocation list.
+type RevokedError struct {
+	Version string
+	Reason  string
+}
+
+func (e *RevokedError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("release %v is revoked: %v", e.Version, e.Reason)
+	}
+	return fmt.Sprintf("release %v is revoked", e.Version)
+}
+
+// rateLimitReset checks response for rate limiting and returns the time
+// when it is safe to retry. GitHub (X-RateLimit-*), GitLab (RateLimit-*)
+// and standard Retry-After headers are supported.
+func rateLimitReset(res *http.Response, now time.Time) (time.Time, bool) {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+
+	if after := res.Header.Get("Retry-After"); after != "" {
+		if secs, err := strconv.Atoi(after); err == nil {
+			return now.Add(time.Duration(secs) * time.Second), true
+		}
+		if at, err := http.ParseTime(after); err == nil {
+			return at, true
+		}
+	}
+
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if res.Header.Get(prefix+"Remaining") != "0" {
+			continue
+		}
+		if reset, err := strconv.ParseInt(res.Header.Get(prefix+"Reset"), 10, 64); err == nil {
+			return time.Unix(reset, 0), true
+		}
+		return time.Time{}, true
+	}
+
+	// 429 is rate limiting even without any hints
+	return time.Time{}, res.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,74 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHTTPErrors(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/limited", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", apiContent)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"message":"API rate limit exceeded"}`)
+	})
+	mux.HandleFunc("/retry", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/forbidden", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "10")
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var rateErr *RateLimitError
+	_, err := httpOpen(context.Background(), nil, srv.URL+"/limited", nil)
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+	if !rateErr.Reset.Equal(reset) || rateErr.Message != "API rate limit exceeded" {
+		t.Errorf("unexpected rate limit error %+v", rateErr)
+	}
+
+	_, err = httpOpen(context.Background(), nil, srv.URL+"/retry", nil)
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+	if wait := time.Until(rateErr.Reset); wait < 50*time.Second || wait > 70*time.Second {
+		t.Errorf("unexpected reset time %v", rateErr.Reset)
+	}
+
+	_, err = httpOpen(context.Background(), nil, srv.URL+"/forbidden", nil)
+	if errors.As(err, &rateErr) || errors.Is(err, ErrNotFound) {
+		t.Errorf("unexpected error kind %v", err)
+	}
+
+	_, err = httpOpen(context.Background(), nil, srv.URL+"/missing", nil)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	srv.Close()
+
+	var netErr *NetworkError
+	_, err = httpOpen(context.Background(), nil, srv.URL+"/missing", nil)
+	if !errors.As(err, &netErr) {
+		t.Errorf("expected network error, got %v", err)
+	}
+}
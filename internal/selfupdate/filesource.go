@@ -0,0 +1,188 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	fileScheme = "file://"
+)
+
+// FileSource is a Source backed by a local directory, e.g. for hosts
+// without network access. Every subdirectory is a release named by its tag
+// and contains binaries with their .msign signatures:
+//
+//	<dir>/v1.2.0/app-linux-amd64
+//	<dir>/v1.2.0/app-linux-amd64.msign
+//
+// Releases are ordered by semantic version of their tags, or by
+// modification time of their directories if tags are not versions.
+type FileSource struct {
+	Dir string
+}
+
+// NewFileSource returns a source for the directory dir, given as a path
+// or a file:// URL.
+func NewFileSource(dir string) (*FileSource, error) {
+	if strings.HasPrefix(dir, fileScheme) {
+		u, err := url.Parse(dir)
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.FromSlash(u.Path)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%q is not a directory", dir)
+	}
+
+	return &FileSource{Dir: dir}, nil
+}
+
+// release reads the release stored in the subdirectory name.
+func (s *FileSource) release(name string) (Release, error) {
+	dir := filepath.Join(s.Dir, name)
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return Release{}, err
+	}
+
+	if !info.IsDir() {
+		return Release{}, fmt.Errorf("%q is not a release directory", dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Release{}, err
+	}
+
+	release := Release{
+		Name:        name,
+		TagName:     name,
+		PublishedAt: info.ModTime(),
+	}
+
+	if v, err := ParseVersion(name); err == nil {
+		release.PreRelease = len(v.PreRelease) > 0
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return Release{}, err
+		}
+
+		release.Assets = append(release.Assets, Asset{
+			Name: entry.Name(),
+			URL:  filepath.Join(dir, entry.Name()),
+			Size: info.Size(),
+		})
+	}
+
+	return release, nil
+}
+
+// LatestRelease returns the first release directory in the ListReleases
+// order, which is not a prerelease.
+func (s *FileSource) LatestRelease(ctx context.Context) (Release, error) {
+	releases, err := s.ListReleases(ctx)
+	if err != nil {
+		return Release{}, err
+	}
+
+	for _, release := range releases {
+		if !release.PreRelease {
+			return release, nil
+		}
+	}
+
+	return Release{}, fmt.Errorf("releases %w in %q", ErrNotFound, s.Dir)
+}
+
+// ReleaseByTag returns the release stored in the directory named tag.
+func (s *FileSource) ReleaseByTag(ctx context.Context, tag string) (Release, error) {
+	if tag == "" || tag != filepath.Base(tag) || tag == "." || tag == ".." {
+		return Release{}, fmt.Errorf("invalid release tag %q", tag)
+	}
+
+	release, err := s.release(tag)
+	if errors.Is(err, os.ErrNotExist) {
+		return Release{}, fmt.Errorf("release %q %w in %q", tag, ErrNotFound, s.Dir)
+	}
+
+	return release, err
+}
+
+// ListReleases returns all releases in the directory. The directories named
+// by semantic versions come first, the highest version first, the others
+// follow, the most recently modified first. Directories named by
+// prerelease versions are prereleases.
+func (s *FileSource) ListReleases(ctx context.Context) ([]Release, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []Release
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		release, err := s.release(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		return newerDir(releases[i], releases[j])
+	})
+
+	return releases, nil
+}
+
+// newerDir reports whether release directory a is listed before b.
+func newerDir(a, b Release) bool {
+	va, aerr := ParseVersion(a.TagName)
+	vb, berr := ParseVersion(b.TagName)
+	switch {
+	case aerr == nil && berr == nil:
+		return va.Compare(vb) > 0
+	case aerr == nil || berr == nil:
+		return aerr == nil
+	}
+
+	return a.PublishedAt.After(b.PublishedAt)
+}
+
+// OpenAsset opens the asset file.
+func (s *FileSource) OpenAsset(ctx context.Context, asset Asset) (io.ReadCloser, error) {
+	f, err := os.Open(asset.URL)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
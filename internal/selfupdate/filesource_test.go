@@ -0,0 +1,113 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Now()
+	for i, tag := range []string{"v1.0.0", "v1.1.0"} {
+		rdir := filepath.Join(dir, tag)
+		if err := os.Mkdir(rdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(rdir, "app"), []byte(tag), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(rdir, "app.msign"), []byte("sign"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i-2) * time.Hour)
+		if err := os.Chtimes(rdir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src, err := NewFileSource("file://" + filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := src.LatestRelease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if release.TagName != "v1.1.0" || len(release.Assets) != 2 {
+		t.Fatalf("unexpected latest release %v", release)
+	}
+
+	data, err := downloadAsset(context.Background(), src, release.Assets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v1.1.0" {
+		t.Errorf("unexpected asset content %q", data)
+	}
+
+	if _, err = src.ReleaseByTag(context.Background(), "v1.0.0"); err != nil {
+		t.Error(err)
+	}
+
+	for _, tag := range []string{"v2.0.0", "..", "../v1.0.0"} {
+		if _, err = src.ReleaseByTag(context.Background(), tag); err == nil {
+			t.Errorf("expected error for tag %q", tag)
+		}
+	}
+
+	if _, err = NewFileSource(filepath.Join(dir, "v1.0.0", "app")); err == nil {
+		t.Error("expected error for non-directory source")
+	}
+}
+
+func TestFileSourceOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	// The latest modified directories are not the newest versions
+	now := time.Now()
+	for i, tag := range []string{"v1.9.0", "v1.10.0", "nightly", "v2.0.0-rc.1", "latest"} {
+		rdir := filepath.Join(dir, tag)
+		if err := os.Mkdir(rdir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i-5) * time.Hour)
+		if err := os.Chtimes(rdir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src := &FileSource{Dir: dir}
+	releases, err := src.ListReleases(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tags []string
+	for _, release := range releases {
+		tags = append(tags, release.TagName)
+	}
+	if strings.Join(tags, " ") != "v2.0.0-rc.1 v1.10.0 v1.9.0 latest nightly" {
+		t.Errorf("unexpected order %v", tags)
+	}
+	if !releases[0].PreRelease || releases[1].PreRelease || releases[3].PreRelease {
+		t.Errorf("unexpected prerelease flags %+v", releases)
+	}
+
+	release, err := src.LatestRelease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.TagName != "v1.10.0" {
+		t.Errorf("unexpected latest release %q", release.TagName)
+	}
+}
@@ -0,0 +1,194 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	gitRegex                = `^(https?|git)(:\/\/|@)([^\/:]+)[\/:]([^\/:]+)\/([^\/\.:]+)(|\.git)$`
+	githubDomain            = "github.com"
+	githubAPIURL            = "https://api.github.com"
+	githubEnterpriseAPIPath = "/api/v3"
+	githubReleasesFormat    = "%s/repos/%s/%s/releases"
+	githubAssetFormat       = "%s/repos/%s/%s/releases/assets/%d"
+	githubAPIAccept         = "application/vnd.github.v3+json"
+	githubAPIAcceptBinaries = "application/octet-stream"
+	githubReleasesPerPage   = 100
+)
+
+// githubRelease is a release as returned by the GitHub API.
+type githubRelease struct {
+	Name        string        `json:"name"`
+	TagName     string        `json:"tag_name"`
+	Draft       bool          `json:"draft"`
+	PreRelease  bool          `json:"prerelease"`
+	PublishedAt time.Time     `json:"published_at"`
+	Assets      []githubAsset `json:"assets"`
+}
+
+// githubAsset is a release asset as returned by the GitHub API.
+type githubAsset struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+}
+
+// release converts r into the provider-neutral model. Asset URLs are built
+// from the API base URL, so downloads go through the same (possibly
+// enterprise) API endpoint as the metadata requests.
+func (s *GitHubSource) release(r githubRelease) Release {
+	release := Release{
+		Name:        r.Name,
+		TagName:     r.TagName,
+		Draft:       r.Draft,
+		PreRelease:  r.PreRelease,
+		PublishedAt: r.PublishedAt,
+	}
+
+	for _, asset := range r.Assets {
+		release.Assets = append(release.Assets, Asset{
+			Name: asset.Name,
+			URL:  fmt.Sprintf(githubAssetFormat, s.apiURL(), s.Owner, s.Repo, asset.ID),
+			Size: asset.Size,
+		})
+	}
+
+	return release
+}
+
+// GitHubSource is a Source backed by GitHub or GitHub Enterprise Server
+// releases.
+type GitHubSource struct {
+	Owner string
+	Repo  string
+
+	// BaseURL is the API base URL, e.g. "https://ghe.corp/api/v3".
+	// https://api.github.com is used if not set.
+	BaseURL string
+
+	// Token is sent with API and asset requests to access private
+	// repositories and get higher rate limits. Anonymous access if empty.
+	Token string
+
+	// Client is used for all requests, http.DefaultClient if not set.
+	Client *http.Client
+}
+
+// NewGitHubSource returns a GitHub source for the repository at giturl.
+// Repositories hosted outside of github.com are treated as GitHub Enterprise
+// Server ones, with the API served at https://<host>/api/v3.
+func NewGitHubSource(giturl string) (*GitHubSource, error) {
+	re := regexp.MustCompile(gitRegex)
+	matches := re.FindStringSubmatch(giturl)
+	if len(matches) < 6 {
+		return nil, fmt.Errorf("invalid GitHub URL %q", giturl)
+	}
+
+	src := &GitHubSource{
+		Owner: matches[4],
+		Repo:  matches[5],
+	}
+
+	if matches[3] != githubDomain {
+		src.BaseURL = "https://" + matches[3] + githubEnterpriseAPIPath
+	}
+
+	return src, nil
+}
+
+func (s *GitHubSource) apiURL() string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	return githubAPIURL
+}
+
+func (s *GitHubSource) releasesURL() string {
+	return fmt.Sprintf(githubReleasesFormat, s.apiURL(), s.Owner, s.Repo)
+}
+
+// LatestRelease uses the GitHub API to get information about the latest
+// release of the repository.
+func (s *GitHubSource) LatestRelease(ctx context.Context) (Release, error) {
+	var release githubRelease
+	if err := s.get(ctx, s.releasesURL()+"/latest", &release); err != nil {
+		return Release{}, err
+	}
+
+	if release.TagName == "" {
+		return Release{}, errors.New("tag name for latest release is empty")
+	}
+
+	return s.release(release), nil
+}
+
+// ReleaseByTag uses the GitHub API to get information about the release
+// with the given tag.
+func (s *GitHubSource) ReleaseByTag(ctx context.Context, tag string) (Release, error) {
+	var release githubRelease
+	if err := s.get(ctx, s.releasesURL()+"/tags/"+url.PathEscape(tag), &release); err != nil {
+		return Release{}, err
+	}
+
+	return s.release(release), nil
+}
+
+// ListReleases uses the GitHub API to get the most recent releases of the
+// repository.
+func (s *GitHubSource) ListReleases(ctx context.Context) ([]Release, error) {
+	var list []githubRelease
+	if err := s.get(ctx, fmt.Sprintf("%s?per_page=%d", s.releasesURL(), githubReleasesPerPage), &list); err != nil {
+		return nil, err
+	}
+
+	releases := make([]Release, 0, len(list))
+	for _, release := range list {
+		releases = append(releases, s.release(release))
+	}
+
+	return releases, nil
+}
+
+// OpenAsset uses the GitHub API to download an asset.
+func (s *GitHubSource) OpenAsset(ctx context.Context, asset Asset) (io.ReadCloser, error) {
+	// request binary data
+	rc, err := httpOpen(ctx, s.Client, asset.URL, s.header(githubAPIAcceptBinaries))
+	return rc, redactError(err, s.Token)
+}
+
+// OpenAssetRange uses the GitHub API to resume the asset download.
+func (s *GitHubSource) OpenAssetRange(ctx context.Context, asset Asset, offset int64, etag string) (AssetRange, error) {
+	body, err := httpOpenRange(ctx, s.Client, asset.URL, s.header(githubAPIAcceptBinaries), offset, etag)
+	return body, redactError(err, s.Token)
+}
+
+// get requests endpoint from the GitHub API and decodes the response into v.
+func (s *GitHubSource) get(ctx context.Context, endpoint string, v interface{}) error {
+	// pin API version 3
+	err := httpGetJSON(ctx, s.Client, endpoint, s.header(githubAPIAccept), v)
+	return redactError(err, s.Token)
+}
+
+// header returns request headers for the GitHub API. The Authorization
+// header is not forwarded by http.Client on redirects to other hosts
+// (e.g. asset storage), so the token stays with the API.
+func (s *GitHubSource) header(accept string) http.Header {
+	header := http.Header{}
+	header.Set("Accept", accept)
+	if s.Token != "" {
+		header.Set("Authorization", "Bearer "+s.Token)
+	}
+	return header
+}
@@ -0,0 +1,146 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newGitHubServer returns a stand-in for the GitHub Enterprise API serving
+// a single release of owner/repo.
+func newGitHubServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/owner/repo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != githubAPIAccept {
+			t.Errorf("unexpected Accept header %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", apiContent)
+		io.WriteString(w, `{"name":"Release 1.0.0","tag_name":"v1.0.0","assets":[{"id":7,"name":"app","url":"https://ignored.example/asset/7","size":4}]}`)
+	})
+	mux.HandleFunc("/api/v3/repos/owner/repo/releases/assets/7", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != githubAPIAcceptBinaries {
+			t.Errorf("unexpected Accept header %q", r.Header.Get("Accept"))
+		}
+		io.WriteString(w, "data")
+	})
+	mux.HandleFunc("/api/v3/repos/owner/missing/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", apiContent)
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message":"Not Found"}`)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestNewGitHubSource(t *testing.T) {
+	tests := []struct {
+		giturl  string
+		owner   string
+		repo    string
+		baseURL string
+	}{
+		{"https://github.com/owner/repo.git", "owner", "repo", ""},
+		{"git@github.com:owner/repo.git", "owner", "repo", ""},
+		{"https://ghe.corp/owner/repo", "owner", "repo", "https://ghe.corp/api/v3"},
+		{"git@ghe.corp:owner/repo.git", "owner", "repo", "https://ghe.corp/api/v3"},
+	}
+
+	for _, test := range tests {
+		src, err := NewGitHubSource(test.giturl)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.giturl, err)
+			continue
+		}
+		if src.Owner != test.owner || src.Repo != test.repo || src.BaseURL != test.baseURL {
+			t.Errorf("%s: got %q %q %q", test.giturl, src.Owner, src.Repo, src.BaseURL)
+		}
+	}
+
+	if _, err := NewGitHubSource("not a git url"); err == nil {
+		t.Error("expected error for invalid URL")
+	}
+}
+
+func TestGitHubSourceEnterprise(t *testing.T) {
+	srv := newGitHubServer(t)
+
+	src := &GitHubSource{Owner: "owner", Repo: "repo", BaseURL: srv.URL + "/api/v3/"}
+
+	release, err := src.LatestRelease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if release.TagName != "v1.0.0" || len(release.Assets) != 1 {
+		t.Fatalf("unexpected release %v", release)
+	}
+
+	asset := release.Assets[0]
+	if asset.URL != srv.URL+"/api/v3/repos/owner/repo/releases/assets/7" {
+		t.Fatalf("unexpected asset URL %q", asset.URL)
+	}
+
+	data, err := downloadAsset(context.Background(), src, asset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "data" {
+		t.Fatalf("unexpected asset content %q", data)
+	}
+
+	src.Repo = "missing"
+	if _, err := src.LatestRelease(context.Background()); err == nil {
+		t.Fatal("expected error for missing repository")
+	}
+}
+
+func TestGitHubSourceToken(t *testing.T) {
+	const token = "secret-token"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", apiContent)
+		io.WriteString(w, `{"tag_name":"v1.0.0","assets":[{"id":1,"name":"app"}]}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/releases/assets/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", apiContent)
+		w.WriteHeader(http.StatusForbidden)
+		// misbehaving server echoing the credentials back
+		io.WriteString(w, `{"message":"Bad credentials: `+token+`"}`)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	src := &GitHubSource{Owner: "owner", Repo: "repo", BaseURL: srv.URL, Token: token}
+
+	release, err := src.LatestRelease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = downloadAsset(context.Background(), src, release.Assets[0])
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if strings.Contains(err.Error(), token) {
+		t.Fatalf("token leaked in error message: %v", err)
+	}
+}
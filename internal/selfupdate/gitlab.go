@@ -0,0 +1,176 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	gitlabRegex           = `^(https?|git)(:\/\/|@)([^\/:]+)[\/:]([^:]+?)(|\.git)$`
+	gitlabDomain          = "gitlab.com"
+	gitlabAPIPath         = "/api/v4"
+	gitlabReleasesFormat  = "%s/projects/%s/releases"
+	gitlabAPIAccept       = "application/json"
+	gitlabReleasesPerPage = 100
+)
+
+// gitlabRelease is a release as returned by the GitLab API.
+type gitlabRelease struct {
+	Name       string    `json:"name"`
+	TagName    string    `json:"tag_name"`
+	Upcoming   bool      `json:"upcoming_release"`
+	ReleasedAt time.Time `json:"released_at"`
+	Assets     struct {
+		Links []gitlabLink `json:"links"`
+	} `json:"assets"`
+}
+
+// gitlabLink is a release link as returned by the GitLab API.
+type gitlabLink struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	DirectAssetURL string `json:"direct_asset_url"`
+}
+
+func (r gitlabRelease) release() Release {
+	release := Release{
+		Name:        r.Name,
+		TagName:     r.TagName,
+		PreRelease:  r.Upcoming,
+		PublishedAt: r.ReleasedAt,
+	}
+
+	for _, link := range r.Assets.Links {
+		asset := Asset{
+			Name: link.Name,
+			URL:  link.DirectAssetURL,
+		}
+		if asset.URL == "" {
+			asset.URL = link.URL
+		}
+		release.Assets = append(release.Assets, asset)
+	}
+
+	return release
+}
+
+// GitLabSource is a Source backed by GitLab releases. Release links are
+// used as assets.
+type GitLabSource struct {
+	// Project is the full project path, e.g. "group/subgroup/repo".
+	Project string
+
+	// BaseURL is the API base URL, e.g. "https://gitlab.corp/api/v4".
+	// https://gitlab.com/api/v4 is used if not set.
+	BaseURL string
+
+	// Client is used for all requests, http.DefaultClient if not set.
+	Client *http.Client
+}
+
+// NewGitLabSource returns a GitLab source for the project at giturl.
+// Projects in nested groups (group/subgroup/repo) are supported.
+func NewGitLabSource(giturl string) (*GitLabSource, error) {
+	re := regexp.MustCompile(gitlabRegex)
+	matches := re.FindStringSubmatch(giturl)
+	if len(matches) < 6 {
+		return nil, fmt.Errorf("invalid GitLab URL %q", giturl)
+	}
+
+	project := strings.Trim(matches[4], "/")
+	if !strings.Contains(project, "/") {
+		return nil, fmt.Errorf("invalid GitLab project path %q", project)
+	}
+
+	return &GitLabSource{
+		Project: project,
+		BaseURL: "https://" + matches[3] + gitlabAPIPath,
+	}, nil
+}
+
+func (s *GitLabSource) apiURL() string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	return "https://" + gitlabDomain + gitlabAPIPath
+}
+
+func (s *GitLabSource) releasesURL() string {
+	return fmt.Sprintf(gitlabReleasesFormat, s.apiURL(), url.PathEscape(s.Project))
+}
+
+// LatestRelease uses the GitLab API to get information about the latest
+// release of the project.
+func (s *GitLabSource) LatestRelease(ctx context.Context) (Release, error) {
+	var release gitlabRelease
+	if err := s.get(ctx, s.releasesURL()+"/permalink/latest", &release); err != nil {
+		return Release{}, err
+	}
+
+	if release.TagName == "" {
+		return Release{}, errors.New("tag name for latest release is empty")
+	}
+
+	return release.release(), nil
+}
+
+// ReleaseByTag uses the GitLab API to get information about the release
+// with the given tag.
+func (s *GitLabSource) ReleaseByTag(ctx context.Context, tag string) (Release, error) {
+	var release gitlabRelease
+	if err := s.get(ctx, s.releasesURL()+"/"+url.PathEscape(tag), &release); err != nil {
+		return Release{}, err
+	}
+
+	return release.release(), nil
+}
+
+// ListReleases uses the GitLab API to get the most recent releases of the
+// project.
+func (s *GitLabSource) ListReleases(ctx context.Context) ([]Release, error) {
+	var list []gitlabRelease
+	if err := s.get(ctx, fmt.Sprintf("%s?per_page=%d", s.releasesURL(), gitlabReleasesPerPage), &list); err != nil {
+		return nil, err
+	}
+
+	releases := make([]Release, 0, len(list))
+	for _, release := range list {
+		releases = append(releases, release.release())
+	}
+
+	return releases, nil
+}
+
+// OpenAsset downloads the release link target.
+func (s *GitLabSource) OpenAsset(ctx context.Context, asset Asset) (io.ReadCloser, error) {
+	return httpOpen(ctx, s.Client, asset.URL, s.header(""))
+}
+
+// OpenAssetRange resumes the release link target download.
+func (s *GitLabSource) OpenAssetRange(ctx context.Context, asset Asset, offset int64, etag string) (AssetRange, error) {
+	return httpOpenRange(ctx, s.Client, asset.URL, s.header(""), offset, etag)
+}
+
+// get requests endpoint from the GitLab API and decodes the response into v.
+func (s *GitLabSource) get(ctx context.Context, endpoint string, v interface{}) error {
+	return httpGetJSON(ctx, s.Client, endpoint, s.header(gitlabAPIAccept), v)
+}
+
+// header returns request headers for the GitLab API.
+func (s *GitLabSource) header(accept string) http.Header {
+	header := http.Header{}
+	if accept != "" {
+		header.Set("Accept", accept)
+	}
+	return header
+}
@@ -0,0 +1,83 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewGitLabSource(t *testing.T) {
+	tests := []struct {
+		giturl  string
+		project string
+		baseURL string
+	}{
+		{"https://gitlab.com/group/repo.git", "group/repo", "https://gitlab.com/api/v4"},
+		{"https://gitlab.com/group/subgroup/repo", "group/subgroup/repo", "https://gitlab.com/api/v4"},
+		{"git@gitlab.corp:group/subgroup/repo.git", "group/subgroup/repo", "https://gitlab.corp/api/v4"},
+	}
+
+	for _, test := range tests {
+		src, err := NewGitLabSource(test.giturl)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.giturl, err)
+			continue
+		}
+		if src.Project != test.project || src.BaseURL != test.baseURL {
+			t.Errorf("%s: got %q %q", test.giturl, src.Project, src.BaseURL)
+		}
+		if provider := DetectProvider(test.giturl); provider != ProviderGitLab {
+			t.Errorf("%s: detected provider %q", test.giturl, provider)
+		}
+	}
+
+	if _, err := NewGitLabSource("https://gitlab.com/repo"); err == nil {
+		t.Error("expected error for project without group")
+	}
+}
+
+func TestGitLabSourceLatestRelease(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/api/v4/projects/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/group%2Fsubgroup%2Frepo/releases/permalink/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", apiContent)
+		io.WriteString(w, `{"name":"v1.0.0","tag_name":"v1.0.0","assets":{"links":[`+
+			`{"name":"app","url":"`+srv.URL+`/link/app","direct_asset_url":"`+srv.URL+`/download/app"},`+
+			`{"name":"app.msign","url":"`+srv.URL+`/download/app.msign"}]}}`)
+	})
+	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	})
+
+	src := &GitLabSource{Project: "group/subgroup/repo", BaseURL: srv.URL + "/api/v4"}
+
+	release, err := src.LatestRelease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if release.TagName != "v1.0.0" || len(release.Assets) != 2 {
+		t.Fatalf("unexpected release %v", release)
+	}
+
+	for _, asset := range release.Assets {
+		data, err := downloadAsset(context.Background(), src, asset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "/download/"+asset.Name {
+			t.Errorf("unexpected content %q for asset %q", data, asset.Name)
+		}
+	}
+}
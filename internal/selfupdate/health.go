@@ -0,0 +1,68 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultHealthCheckTimeout limits the health check run of the installed
+// binary.
+const DefaultHealthCheckTimeout = 10 * time.Second
+
+// healthCheck runs binary with args and checks that it exits successfully
+// within timeout and reports the expected version. The version is the whole
+// output of the binary or the "version" field, if the output is JSON.
+// Cancellation of ctx is reported as is, not as a failed health check.
+func healthCheck(ctx context.Context, binary string, args []string, timeout time.Duration, version string) error {
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("health check of %s: %w", version, ctx.Err())
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return &HealthCheckError{Version: version, Err: fmt.Errorf("no response in %v", timeout)}
+	}
+	if err != nil {
+		return &HealthCheckError{Version: version, Output: strings.TrimSpace(stderr.String()), Err: err}
+	}
+
+	reported := healthVersion(stdout.Bytes())
+	if c, ok := compareVersions(reported, version); reported != version && !(ok && c == 0) {
+		return &HealthCheckError{Version: version, Err: fmt.Errorf("unexpected version %q reported", reported)}
+	}
+
+	return nil
+}
+
+// healthVersion returns the version reported by the binary.
+func healthVersion(output []byte) string {
+	var info struct {
+		Version string `json:"version"`
+	}
+
+	if err := json.Unmarshal(output, &info); err == nil {
+		return info.Version
+	}
+
+	return strings.TrimSpace(string(output))
+}
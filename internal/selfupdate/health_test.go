@@ -0,0 +1,160 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestHealthCheckHelper is run by TestHealthCheck as the checked binary.
+func TestHealthCheckHelper(t *testing.T) {
+	switch os.Getenv("SELFUPDATE_HEALTH_HELPER") {
+	case "":
+		return
+	case "hang":
+		time.Sleep(time.Minute)
+	case "crash":
+		fmt.Fprintln(os.Stderr, "panic: boom")
+		os.Exit(2)
+	default:
+		fmt.Printf(`{"version": %q}`+"\n", os.Getenv("SELFUPDATE_HEALTH_HELPER"))
+	}
+	os.Exit(0)
+}
+
+func TestHealthCheck(t *testing.T) {
+	args := []string{"-test.run=^TestHealthCheckHelper$"}
+
+	// Only the hanging binary waits for the timeout, the others have time
+	// to start and exit on a loaded machine
+	tests := []struct {
+		helper  string
+		timeout time.Duration
+		ok      bool
+	}{
+		{"v1.2.0", DefaultHealthCheckTimeout, true},
+		{"1.2.0", DefaultHealthCheckTimeout, true},
+		{"v1.1.0", DefaultHealthCheckTimeout, false},
+		{"crash", DefaultHealthCheckTimeout, false},
+		{"hang", time.Second, false},
+	}
+
+	for _, test := range tests {
+		t.Setenv("SELFUPDATE_HEALTH_HELPER", test.helper)
+
+		err := healthCheck(context.Background(), os.Args[0], args, test.timeout, "v1.2.0")
+		if test.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.helper, err)
+		}
+
+		var healthErr *HealthCheckError
+		if !test.ok && !errors.As(err, &healthErr) {
+			t.Errorf("%s: expected health check error, got %v", test.helper, err)
+		}
+	}
+
+	// The cancelled update is not reported as failed health check
+	t.Setenv("SELFUPDATE_HEALTH_HELPER", "hang")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var healthErr *HealthCheckError
+	err := healthCheck(ctx, os.Args[0], args, time.Second, "v1.2.0")
+	if !errors.Is(err, context.Canceled) || errors.As(err, &healthErr) {
+		t.Errorf("expected cancellation error, got %v", err)
+	}
+
+	if v := healthVersion([]byte("v1.2.0\n")); v != "v1.2.0" {
+		t.Errorf("unexpected plain version %q", v)
+	}
+}
+
+func TestUpdaterApplyHealthCheckRestore(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	if err := os.WriteFile(target, []byte("v1.0.0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new binary is not executable, so the health check fails
+	priv, pub := testKey(t)
+	binary := []byte("v1.1.0")
+	src := &memSource{
+		releases: []Release{{TagName: "v1.1.0", Assets: []Asset{
+			{Name: "app", URL: "app", Size: int64(len(binary))},
+			{Name: "app" + signExt, URL: "app.msign"},
+		}}},
+		data: map[string][]byte{"app": binary, "app.msign": testSign(t, priv, binary)},
+	}
+
+	store := &BackupStore{Dir: filepath.Join(dir, "backups")}
+	u, err := New(WithSource(src), WithBinary("app"), WithCurrentVersion("v1.0.0"), WithTarget(target), WithBackupStore(store),
+		WithPublicKeys(pub), WithHealthCheck(DefaultHealthCheckTimeout, "--version"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var healthErr *HealthCheckError
+	if _, err = u.Apply(context.Background()); !errors.As(err, &healthErr) {
+		t.Fatalf("expected health check error, got %v", err)
+	}
+
+	if cont, _ := os.ReadFile(target); string(cont) != "v1.0.0" {
+		t.Errorf("unexpected target content %q", cont)
+	}
+	if _, err = os.Stat(target + backupExt); !os.IsNotExist(err) {
+		t.Errorf("backup is left in place: %v", err)
+	}
+	if backups, _ := u.History(); len(backups) != 0 {
+		t.Errorf("unexpected history %+v", backups)
+	}
+}
+
+func TestUpdaterApplyHealthCheckSince(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	if err := os.WriteFile(target, []byte("v1.0.0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new binary is not executable, but predates the health check
+	priv, pub := testKey(t)
+	binary := []byte("v1.1.0")
+	src := &memSource{
+		releases: []Release{{TagName: "v1.1.0", Assets: []Asset{
+			{Name: "app", URL: "app", Size: int64(len(binary))},
+			{Name: "app" + signExt, URL: "app.msign"},
+		}}},
+		data: map[string][]byte{"app": binary, "app.msign": testSign(t, priv, binary)},
+	}
+
+	store := &BackupStore{Dir: filepath.Join(dir, "backups")}
+	u, err := New(WithSource(src), WithBinary("app"), WithCurrentVersion("v1.0.0"), WithTarget(target), WithBackupStore(store),
+		WithPublicKeys(pub), WithHealthCheck(DefaultHealthCheckTimeout, "--version"), WithHealthCheckSince("v1.2.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := u.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != ActionUpdated {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if cont, _ := os.ReadFile(target); string(cont) != "v1.1.0" {
+		t.Errorf("unexpected target content %q", cont)
+	}
+
+	for version, expected := range map[string]bool{"v1.2.0": true, "v1.3.0": true, "v1.1.9": false, "dev": true} {
+		if ok := u.healthCheckable(version); ok != expected {
+			t.Errorf("%s: got %v, expected %v", version, ok, expected)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiTimeout = 30 * time.Second
+	apiContent = "application/json"
+)
+
+// apiError is returned by the release APIs, e.g. for rate-limiting.
+type apiError struct {
+	Message string
+}
+
+// redactedError hides a secret (e.g. access token) in the error message.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError makes sure secret never appears in the message of err.
+func redactError(err error, secret string) error {
+	if err == nil || secret == "" || !strings.Contains(err.Error(), secret) {
+		return err
+	}
+	return &redactedError{msg: strings.ReplaceAll(err.Error(), secret, "[REDACTED]"), err: err}
+}
+
+// httpOpen sends a GET request for endpoint and returns the response body.
+// The caller is responsible for closing it.
+func httpOpen(ctx context.Context, client *http.Client, endpoint string, header http.Header) (io.ReadCloser, error) {
+	res, err := httpDo(ctx, client, endpoint, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// httpOpenRange sends a GET request for endpoint content from offset, if
+// it is not changed since etag was received, and returns the response body.
+// The whole content is returned if the server does not support ranges.
+func httpOpenRange(ctx context.Context, client *http.Client, endpoint string, header http.Header, offset int64, etag string) (AssetRange, error) {
+	// Weak validators can not be used for ranges
+	resume := offset > 0 && etag != "" && !strings.HasPrefix(etag, "W/")
+
+	rangeHeader := header.Clone()
+	if rangeHeader == nil {
+		rangeHeader = http.Header{}
+	}
+	if resume {
+		rangeHeader.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		rangeHeader.Set("If-Range", etag)
+	}
+
+	res, err := httpDo(ctx, client, endpoint, rangeHeader)
+	var status *StatusError
+	if resume && errors.As(err, &status) && status.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return httpOpenRange(ctx, client, endpoint, header, 0, "")
+	}
+	if err != nil {
+		return AssetRange{}, err
+	}
+
+	body := AssetRange{Body: res.Body, ETag: res.Header.Get("ETag")}
+	if strings.HasPrefix(body.ETag, "W/") {
+		body.ETag = ""
+	}
+
+	if res.StatusCode == http.StatusPartialContent {
+		if !resume || contentRangeStart(res.Header.Get("Content-Range")) != offset {
+			res.Body.Close()
+			return AssetRange{}, fmt.Errorf("unexpected content range %q", res.Header.Get("Content-Range"))
+		}
+		body.Offset = offset
+		body.ETag = etag
+	}
+
+	return body, nil
+}
+
+// contentRangeStart returns the first byte position of the Content-Range
+// header value, or -1 if it is not valid.
+func contentRangeStart(value string) int64 {
+	var start, end int64
+	if _, err := fmt.Sscanf(value, "bytes %d-%d/", &start, &end); err != nil {
+		return -1
+	}
+	return start
+}
+
+// httpDo sends a GET request for endpoint and returns the response with
+// either full or partial content.
+func httpDo(ctx context.Context, client *http.Client, endpoint string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	// If we got an error, and the context has been canceled,
+	// the context's error is probably more useful.
+	if err != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		return nil, &NetworkError{Err: err}
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		defer res.Body.Close()
+
+		status := StatusError{StatusCode: res.StatusCode, Status: res.Status}
+
+		content := res.Header.Get("Content-Type")
+		if strings.Contains(content, apiContent) {
+			// try to decode error message
+			var msg apiError
+			if jerr := json.NewDecoder(res.Body).Decode(&msg); jerr == nil {
+				status.Message = msg.Message
+			}
+		}
+
+		if reset, limited := rateLimitReset(res, time.Now()); limited {
+			return nil, &RateLimitError{StatusError: status, Reset: reset}
+		}
+
+		return nil, &status
+	}
+
+	return res, nil
+}
+
+// httpGetJSON requests endpoint and decodes the JSON response into v.
+func httpGetJSON(ctx context.Context, client *http.Client, endpoint string, header http.Header, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+
+	body, err := httpOpen(ctx, client, endpoint, header)
+	if err != nil {
+		return err
+	}
+
+	buf, err := io.ReadAll(body)
+	if err != nil {
+		_ = body.Close()
+		return err
+	}
+
+	err = body.Close()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+}
@@ -0,0 +1,224 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/m-sign/msign"
+)
+
+const (
+	// keyringAsset is the release asset with the new trusted keyring, it is
+	// signed by a key of the current keyring.
+	keyringAsset = "keyring.json"
+	// keyringExt is the suffix of the keyring file next to the executable.
+	keyringExt = ".keyring.json"
+)
+
+var (
+	// msignKeyID is the identifier of the built-in public key.
+	msignKeyID = "builtin"
+)
+
+// TrustedKey is a msign public key trusted to sign the releases.
+type TrustedKey struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+}
+
+// Keyring is a set of trusted public keys. Serial is increased with every
+// change of the keyring, a keyring with lower serial never replaces the
+// installed one. Threshold is the number of keys required to sign
+// a release, any single key is enough if it is not set.
+type Keyring struct {
+	Serial    int          `json:"serial"`
+	Threshold int          `json:"threshold,omitempty"`
+	Keys      []TrustedKey `json:"keys"`
+}
+
+// builtinKeyring returns the keyring with the built-in public key.
+func builtinKeyring() *Keyring {
+	return &Keyring{Keys: []TrustedKey{{ID: msignKeyID, Key: msignPublic}}}
+}
+
+// keyringOf returns the keyring with keys, identified by their index.
+func keyringOf(keys []string) *Keyring {
+	keyring := &Keyring{}
+	for i, key := range keys {
+		keyring.Keys = append(keyring.Keys, TrustedKey{ID: strconv.Itoa(i + 1), Key: key})
+	}
+	return keyring
+}
+
+// ParseKeyring parses and validates JSON keyring.
+func ParseKeyring(data []byte) (*Keyring, error) {
+	keyring := &Keyring{}
+	if err := json.Unmarshal(data, keyring); err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+
+	if err := keyring.Validate(); err != nil {
+		return nil, err
+	}
+
+	return keyring, nil
+}
+
+// Validate checks that the keyring has keys with unique identifiers and
+// the threshold could be reached.
+func (k *Keyring) Validate() error {
+	if len(k.Keys) == 0 {
+		return errors.New("keyring: no keys")
+	}
+
+	if k.Threshold < 0 || k.Threshold > len(k.Keys) {
+		return fmt.Errorf("keyring: threshold %d of %d keys", k.Threshold, len(k.Keys))
+	}
+
+	ids := map[string]bool{}
+	pubs := map[string]string{}
+	for _, key := range k.Keys {
+		if key.ID == "" {
+			return errors.New("keyring: key identifier is not set")
+		}
+		if ids[key.ID] {
+			return fmt.Errorf("keyring: duplicate key %q", key.ID)
+		}
+		ids[key.ID] = true
+
+		pub, err := msign.ImportPublicKey(strings.NewReader(publicKey(key.Key)))
+		if err != nil {
+			return fmt.Errorf("keyring: key %q: %w", key.ID, err)
+		}
+
+		// The same key under two identifiers would count twice to the threshold
+		if id, ok := pubs[string(pub.Id())]; ok {
+			return fmt.Errorf("keyring: key %q duplicates key %q", key.ID, id)
+		}
+		pubs[string(pub.Id())] = key.ID
+	}
+
+	return nil
+}
+
+// IDs returns identifiers of the keys.
+func (k *Keyring) IDs() []string {
+	ids := make([]string, 0, len(k.Keys))
+	for _, key := range k.Keys {
+		ids = append(ids, key.ID)
+	}
+	return ids
+}
+
+// LoadKeyring reads the keyring from file, the built-in keyring is returned
+// if the file does not exist.
+func LoadKeyring(file string) (*Keyring, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return builtinKeyring(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKeyring(data)
+}
+
+// Save writes the keyring to file.
+func (k *Keyring) Save(file string) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(file+newExt, data, 0644); err != nil {
+		os.Remove(file + newExt) // clean up
+		return err
+	}
+
+	return os.Rename(file+newExt, file)
+}
+
+// keyringPath returns the keyring file of executable.
+func keyringPath(executable string) string {
+	return filepath.Join(filepath.Dir(executable), "."+filepath.Base(executable)+keyringExt)
+}
+
+// loadKeyring reads the keyring file of the updater.
+func (u *Updater) loadKeyring() (*Keyring, error) {
+	if u.keyringFile == "" {
+		target, err := u.targetPath()
+		if err != nil {
+			u.log.Verbose(fmt.Sprintf("Keyring file is not known, the built-in key is used: %v", err))
+			return builtinKeyring(), nil
+		}
+		u.keyringFile = keyringPath(target)
+	}
+
+	return LoadKeyring(u.keyringFile)
+}
+
+// releaseKeyring downloads and verifies the keyring delivered by the
+// release. It returns nil if the release has no keyring, its serial is
+// not newer than the trusted one or the keyring is set explicitly.
+func (u *Updater) releaseKeyring(ctx context.Context, release Release) (*Keyring, error) {
+	if u.keyringFile == "" {
+		return nil, nil
+	}
+
+	var keyring Asset
+	for _, asset := range release.Assets {
+		if asset.Name == keyringAsset {
+			keyring = asset
+		}
+	}
+
+	if keyring.Name == "" {
+		return nil, nil
+	}
+
+	signs := signatureAssets(release.Assets, keyringAsset, u.keyring)
+	if len(signs) == 0 {
+		return nil, fmt.Errorf("keyring sign asset %q %w", keyringAsset+signExt, ErrNotFound)
+	}
+
+	signData, err := u.downloadSignatures(ctx, signs)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+
+	done := u.progress.start(PhaseDownload, keyring.Name, keyring.Size)
+	data, err := downloadAsset(ctx, u.source, keyring)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+
+	done = u.progress.start(PhaseVerify, keyring.Name, 0)
+	_, err = verifySignaturesData(u.keyring, u.threshold(), data, signData)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+
+	next, err := ParseKeyring(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if next.Serial <= u.keyring.Serial {
+		u.log.Verbose(fmt.Sprintf("Keyring serial %d is not newer than %d, skipped", next.Serial, u.keyring.Serial))
+		return nil, nil
+	}
+
+	return next, nil
+}
@@ -0,0 +1,77 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseKeyring(t *testing.T) {
+	_, newPublic := testKey(t)
+	tests := []struct {
+		keys []TrustedKey
+		ok   bool
+	}{
+		{[]TrustedKey{{ID: "2023", Key: msignPublic}, {ID: "2024", Key: newPublic}}, true},
+		{[]TrustedKey{{ID: "2023", Key: msignPublic}, {ID: "2024", Key: msignPublic}}, false},
+		{nil, false},
+		{[]TrustedKey{{Key: msignPublic}}, false},
+		{[]TrustedKey{{ID: "2023", Key: msignPublic}, {ID: "2023", Key: msignPublic}}, false},
+		{[]TrustedKey{{ID: "2023", Key: "invalid"}}, false},
+	}
+
+	for i, test := range tests {
+		data, _ := json.Marshal(Keyring{Serial: 1, Keys: test.keys})
+		if _, err := ParseKeyring(data); (err == nil) != test.ok {
+			t.Errorf("%d: unexpected result: %v", i, err)
+		}
+	}
+}
+
+func TestKeyringFile(t *testing.T) {
+	file := keyringPath(filepath.Join(t.TempDir(), "app"))
+
+	keyring, err := LoadKeyring(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := keyring.IDs(); len(ids) != 1 || ids[0] != msignKeyID || keyring.Serial != 0 {
+		t.Errorf("expected built-in keyring, got %+v", keyring)
+	}
+
+	keyring = &Keyring{Serial: 2, Keys: []TrustedKey{{ID: "2024", Key: msignPublic}}}
+	if err = keyring.Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadKeyring(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := loaded.IDs(); len(ids) != 1 || ids[0] != "2024" || loaded.Serial != 2 {
+		t.Errorf("unexpected loaded keyring %+v", loaded)
+	}
+}
+
+func TestVerifySignatureSecondKey(t *testing.T) {
+	_, oldKey := testKey(t)
+	newPriv, newKey := testKey(t)
+	otherPriv, _ := testKey(t)
+	keyring := &Keyring{Keys: []TrustedKey{{ID: "old", Key: oldKey}, {ID: "new", Key: newKey}}}
+	data := []byte("binary")
+
+	if err := verifySignatureData(keyring, data, testSign(t, newPriv, data)); err != nil {
+		t.Errorf("signature of the second key: %v", err)
+	}
+
+	if err := verifySignatureData(keyring, []byte("tampered"), testSign(t, newPriv, data)); err == nil {
+		t.Error("expected error for tampered data")
+	}
+
+	if err := verifySignatureData(keyring, data, testSign(t, otherPriv, data)); err == nil {
+		t.Error("expected error for untrusted key")
+	}
+}
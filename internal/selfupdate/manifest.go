@@ -0,0 +1,33 @@
+package selfupdate
+
+import "time"
+
+// ManifestName is the default file name of a release manifest.
+const ManifestName = "releases.json"
+
+// Manifest is a release manifest published on a plain HTTP(S) artifact
+// server, next to the binaries. The manifest is signed with msign and the
+// signature is stored as <manifest>.msign.
+type Manifest struct {
+	Releases []ManifestRelease `json:"releases"`
+}
+
+// ManifestRelease describes a single release in a manifest.
+type ManifestRelease struct {
+	Version     string          `json:"version"`
+	Name        string          `json:"name,omitempty"`
+	PreRelease  bool            `json:"prerelease,omitempty"`
+	PublishedAt time.Time       `json:"published_at"`
+	Assets      []ManifestAsset `json:"assets"`
+}
+
+// ManifestAsset describes a file of a release. URL may be relative to the
+// manifest location.
+type ManifestAsset struct {
+	Name   string `json:"name"`
+	GOOS   string `json:"goos,omitempty"`
+	GOARCH string `json:"goarch,omitempty"`
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
@@ -0,0 +1,189 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+)
+
+const (
+	manifestSignExt = ".msign"
+)
+
+// ManifestSource is a Source backed by a signed release manifest served
+// from any HTTPS server (e.g. nginx or an S3 bucket).
+type ManifestSource struct {
+	// URL is the location of the manifest. The signature is expected
+	// at URL + ".msign".
+	URL string
+
+	// Client is used for all requests, http.DefaultClient if not set.
+	Client *http.Client
+
+	// Keyring is trusted for the manifest signature, the built-in key is
+	// used if not set.
+	Keyring *Keyring
+}
+
+// NewManifestSource returns a source for the manifest at manifestURL.
+func NewManifestSource(manifestURL string) (*ManifestSource, error) {
+	u, err := url.Parse(manifestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid manifest URL %q, https is required", manifestURL)
+	}
+
+	return &ManifestSource{URL: manifestURL}, nil
+}
+
+// manifest downloads the manifest and verifies its signature.
+func (s *ManifestSource) manifest(ctx context.Context) (Manifest, error) {
+	data, err := s.fetch(ctx, s.URL)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	sign, err := s.fetch(ctx, s.URL+manifestSignExt)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	if err = verifySignatureData(s.Keyring, data, sign); err != nil {
+		return Manifest{}, fmt.Errorf("manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+func (s *ManifestSource) fetch(ctx context.Context, endpoint string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiTimeout)
+	defer cancel()
+
+	body, err := httpOpen(ctx, s.Client, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		_ = body.Close()
+		return nil, err
+	}
+
+	return data, body.Close()
+}
+
+// release converts r into the provider-neutral model. Only assets for the
+// current platform are kept, relative asset URLs are resolved against the
+// manifest URL.
+func (s *ManifestSource) release(r ManifestRelease) (Release, error) {
+	base, err := url.Parse(s.URL)
+	if err != nil {
+		return Release{}, err
+	}
+
+	release := Release{
+		Name:        r.Name,
+		TagName:     r.Version,
+		PreRelease:  r.PreRelease,
+		PublishedAt: r.PublishedAt,
+	}
+
+	for _, asset := range r.Assets {
+		if (asset.GOOS != "" && asset.GOOS != runtime.GOOS) ||
+			(asset.GOARCH != "" && asset.GOARCH != runtime.GOARCH) {
+			continue
+		}
+
+		u, err := base.Parse(asset.URL)
+		if err != nil {
+			return Release{}, fmt.Errorf("manifest: asset %q: %w", asset.Name, err)
+		}
+
+		release.Assets = append(release.Assets, Asset{
+			Name:   asset.Name,
+			URL:    u.String(),
+			Size:   asset.Size,
+			SHA256: asset.SHA256,
+		})
+	}
+
+	return release, nil
+}
+
+// LatestRelease returns the newest release in the manifest, which is not
+// a prerelease. The releases are compared by semantic version, so their
+// order in the manifest does not matter.
+func (s *ManifestSource) LatestRelease(ctx context.Context) (Release, error) {
+	releases, err := s.ListReleases(ctx)
+	if err != nil {
+		return Release{}, err
+	}
+
+	latest, ok := newestRelease(releases, ChannelStable)
+	if !ok {
+		return Release{}, fmt.Errorf("releases %w in manifest", ErrNotFound)
+	}
+
+	return latest, nil
+}
+
+// ReleaseByTag returns the release with the given version.
+func (s *ManifestSource) ReleaseByTag(ctx context.Context, tag string) (Release, error) {
+	manifest, err := s.manifest(ctx)
+	if err != nil {
+		return Release{}, err
+	}
+
+	for _, release := range manifest.Releases {
+		if release.Version == tag {
+			return s.release(release)
+		}
+	}
+
+	return Release{}, fmt.Errorf("release %q %w in manifest", tag, ErrNotFound)
+}
+
+// ListReleases returns all releases listed in the manifest.
+func (s *ManifestSource) ListReleases(ctx context.Context) ([]Release, error) {
+	manifest, err := s.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make([]Release, 0, len(manifest.Releases))
+	for _, r := range manifest.Releases {
+		release, err := s.release(r)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+
+	return releases, nil
+}
+
+// OpenAsset downloads the asset from the artifact server.
+func (s *ManifestSource) OpenAsset(ctx context.Context, asset Asset) (io.ReadCloser, error) {
+	return httpOpen(ctx, s.Client, asset.URL, nil)
+}
+
+// OpenAssetRange resumes the asset download from the artifact server.
+func (s *ManifestSource) OpenAssetRange(ctx context.Context, asset Asset, offset int64, etag string) (AssetRange, error) {
+	return httpOpenRange(ctx, s.Client, asset.URL, nil, offset, etag)
+}
@@ -0,0 +1,100 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestNewManifestSource(t *testing.T) {
+	if _, err := NewManifestSource("https://artifacts.corp/app/releases.json"); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewManifestSource("http://artifacts.corp/app/releases.json"); err == nil {
+		t.Error("expected error for plain http manifest URL")
+	}
+}
+
+func TestManifestSourceRelease(t *testing.T) {
+	src := &ManifestSource{URL: "https://artifacts.corp/app/releases.json"}
+
+	release, err := src.release(ManifestRelease{
+		Version: "v1.0.0",
+		Assets: []ManifestAsset{
+			{Name: "app", GOOS: runtime.GOOS, GOARCH: runtime.GOARCH, URL: "v1.0.0/app", Size: 4, SHA256: "00"},
+			{Name: "app.msign", URL: "https://cdn.corp/app.msign"},
+			{Name: "app-other", GOOS: "plan9", GOARCH: "other", URL: "v1.0.0/app-other"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if release.TagName != "v1.0.0" || len(release.Assets) != 2 {
+		t.Fatalf("unexpected release %v", release)
+	}
+
+	if release.Assets[0].URL != "https://artifacts.corp/app/v1.0.0/app" ||
+		release.Assets[0].Size != 4 || release.Assets[0].SHA256 != "00" {
+		t.Errorf("unexpected asset %+v", release.Assets[0])
+	}
+
+	if release.Assets[1].URL != "https://cdn.corp/app.msign" {
+		t.Errorf("unexpected asset %+v", release.Assets[1])
+	}
+}
+
+func TestManifestSourceBadSignature(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases.json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"releases":[{"version":"v1.0.0","assets":[]}]}`)
+	})
+	mux.HandleFunc("/releases.json.msign", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "not a signature")
+	})
+
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	src := &ManifestSource{URL: srv.URL + "/releases.json", Client: srv.Client()}
+	if _, err := src.LatestRelease(context.Background()); err == nil {
+		t.Fatal("expected signature verification error")
+	}
+}
+
+func TestManifestSourceLatestRelease(t *testing.T) {
+	priv, pub := testKey(t)
+	manifest := []byte(`{"releases":[
+		{"version":"v1.1.1","assets":[]},
+		{"version":"v2.0.0-rc.1","prerelease":true,"assets":[]},
+		{"version":"v1.2.0","assets":[]},
+		{"version":"v1.0.0","assets":[]}
+	]}`)
+	sign := testSign(t, priv, manifest)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(manifest)
+	})
+	mux.HandleFunc("/releases.json.msign", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(sign)
+	})
+
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	src := &ManifestSource{URL: srv.URL + "/releases.json", Client: srv.Client(), Keyring: &Keyring{Keys: []TrustedKey{{ID: "release", Key: pub}}}}
+	release, err := src.LatestRelease(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.TagName != "v1.2.0" {
+		t.Errorf("unexpected latest release %q", release.TagName)
+	}
+}
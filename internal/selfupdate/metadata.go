@@ -0,0 +1,19 @@
+package selfupdate
+
+import "time"
+
+// MetadataExt is the suffix of the release metadata of a binary asset,
+// <binary>.metadata.json. The metadata is signed with msign like the binary.
+const MetadataExt = ".metadata.json"
+
+// Metadata is the signed release metadata of a binary asset. It binds the
+// binary digest to the release version and platform, and limits the time
+// the release could be served as the current one.
+type Metadata struct {
+	Version string `json:"version"`
+	// Platform is GOOS/GOARCH of the binary.
+	Platform string    `json:"platform,omitempty"`
+	Binary   string    `json:"binary"`
+	SHA256   string    `json:"sha256"`
+	Expires  time.Time `json:"expires"`
+}
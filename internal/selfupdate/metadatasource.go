@@ -0,0 +1,139 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// releaseMetadata downloads the metadata of the candidate binary, verifies
+// its signatures and checks it against the release. It returns nil if the
+// release has no metadata and it is not required. The metadata is required
+// if the release has to be signed by several keys.
+func (u *Updater) releaseMetadata(ctx context.Context, res *CheckResult) (*Metadata, error) {
+	name := res.Binary.Name + MetadataExt
+
+	var asset Asset
+	for _, a := range res.Candidate.Assets {
+		if a.Name == name {
+			asset = a
+		}
+	}
+
+	if asset.Name == "" {
+		if u.requireMetadata || u.threshold() > 1 {
+			return nil, fmt.Errorf("release metadata asset %q %w", name, ErrNotFound)
+		}
+		u.log.Warning(fmt.Sprintf("Release %s has no metadata, its freshness is not verified", res.Candidate.TagName))
+		return nil, nil
+	}
+
+	signs, err := u.downloadSignatures(ctx, signatureAssets(res.Candidate.Assets, name, u.keyring))
+	if err != nil {
+		return nil, fmt.Errorf("release metadata: %w", err)
+	}
+
+	done := u.progress.start(PhaseDownload, asset.Name, asset.Size)
+	data, err := downloadAsset(ctx, u.source, asset)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("release metadata: %w", err)
+	}
+
+	done = u.progress.start(PhaseVerify, asset.Name, 0)
+	md, err := u.checkMetadata(res, data, signs)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return md, nil
+}
+
+// checkMetadata verifies signatures of the metadata and checks it against
+// the candidate release. The version is checked against the current one
+// only if the candidate is to be installed.
+func (u *Updater) checkMetadata(res *CheckResult, data []byte, signs map[string][]byte) (*Metadata, error) {
+	if _, err := verifySignaturesData(u.keyring, u.threshold(), data, signs); err != nil {
+		return nil, fmt.Errorf("release metadata: %w", err)
+	}
+
+	var md Metadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("release metadata: %w", err)
+	}
+
+	if err := verifyMetadata(md, res.Candidate.TagName, res.Binary.Name, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if res.Update {
+		if err := verifyMetadataVersion(md, res.Candidate.TagName, u.current, u.allowDowngrade); err != nil {
+			return nil, err
+		}
+	}
+
+	return &md, nil
+}
+
+// verifyMetadata checks that md is issued for the binary of the release tag
+// and the current platform and it is not expired at now.
+func verifyMetadata(md Metadata, tag string, binary string, now time.Time) error {
+	reject := func(format string, a ...interface{}) error {
+		return &MetadataError{Version: tag, Err: fmt.Errorf(format, a...)}
+	}
+
+	if md.Binary != binary {
+		return reject("issued for binary %q", md.Binary)
+	}
+
+	if c, ok := compareVersions(md.Version, tag); md.Version != tag && !(ok && c == 0) {
+		return reject("issued for version %q", md.Version)
+	}
+
+	if platform := runtime.GOOS + "/" + runtime.GOARCH; md.Platform != "" && md.Platform != platform {
+		return reject("issued for platform %q", md.Platform)
+	}
+
+	if sum, err := hex.DecodeString(md.SHA256); err != nil || len(sum) != 32 {
+		return reject("invalid SHA-256 digest %q", md.SHA256)
+	}
+
+	if md.Expires.IsZero() {
+		return reject("expiry is not set")
+	}
+
+	if now.After(md.Expires) {
+		return reject("expired at %v", md.Expires.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
+
+// verifyMetadataVersion checks that the version of md is not older than the
+// current one, unless downgrade is allowed.
+func verifyMetadataVersion(md Metadata, tag string, current string, allowDowngrade bool) error {
+	if c, ok := compareVersions(md.Version, current); ok && c < 0 && !allowDowngrade {
+		return &MetadataError{Version: tag, Err: fmt.Errorf("version %v is older than installed %v", md.Version, current)}
+	}
+
+	return nil
+}
+
+// pinDigest sets SHA-256 digest of the binary asset to sum from the verified
+// source, the download fails if the binary does not match it then.
+func pinDigest(binary *Asset, sum string, source string) error {
+	if binary.SHA256 != "" && !strings.EqualFold(binary.SHA256, sum) {
+		return fmt.Errorf("asset %q: SHA-256 digest mismatch with %s", binary.Name, source)
+	}
+
+	binary.SHA256 = sum
+	return nil
+}
@@ -0,0 +1,149 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyMetadata(t *testing.T) {
+	now := time.Now()
+	valid := Metadata{
+		Version:  "v1.2.0",
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+		Binary:   "app",
+		SHA256:   strings.Repeat("ab", 32),
+		Expires:  now.Add(time.Hour),
+	}
+
+	tests := []struct {
+		name   string
+		modify func(md *Metadata)
+		ok     bool
+	}{
+		{"valid", func(md *Metadata) {}, true},
+		{"no platform", func(md *Metadata) { md.Platform = "" }, true},
+		{"other binary", func(md *Metadata) { md.Binary = "app.exe" }, false},
+		{"other version", func(md *Metadata) { md.Version = "v1.0.0" }, false},
+		{"other platform", func(md *Metadata) { md.Platform = "plan9/386" }, false},
+		{"invalid digest", func(md *Metadata) { md.SHA256 = "abcd" }, false},
+		{"no expiry", func(md *Metadata) { md.Expires = time.Time{} }, false},
+		{"expired", func(md *Metadata) { md.Expires = now.Add(-time.Minute) }, false},
+	}
+
+	for _, test := range tests {
+		md := valid
+		test.modify(&md)
+
+		err := verifyMetadata(md, "v1.2.0", "app", now)
+		if test.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+
+		var mdErr *MetadataError
+		if !test.ok && !errors.As(err, &mdErr) {
+			t.Errorf("%s: expected metadata error, got %v", test.name, err)
+		}
+	}
+}
+
+func TestVerifyMetadataVersion(t *testing.T) {
+	md := Metadata{Version: "v1.2.0"}
+
+	tests := []struct {
+		name      string
+		current   string
+		downgrade bool
+		ok        bool
+	}{
+		{"newer", "v1.1.0", false, true},
+		{"older", "v1.3.0", false, false},
+		{"older downgrade", "v1.3.0", true, true},
+		{"not comparable", "dev", false, true},
+	}
+
+	for _, test := range tests {
+		err := verifyMetadataVersion(md, "v1.2.0", test.current, test.downgrade)
+		if test.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+
+		var mdErr *MetadataError
+		if !test.ok && !errors.As(err, &mdErr) {
+			t.Errorf("%s: expected metadata error, got %v", test.name, err)
+		}
+	}
+}
+
+func TestUpdaterCheckOlderMetadata(t *testing.T) {
+	priv, pub := testKey(t)
+	data, err := json.Marshal(Metadata{
+		Version: "v1.2.0",
+		Binary:  "app",
+		SHA256:  strings.Repeat("ab", 32),
+		Expires: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &memSource{
+		releases: []Release{{TagName: "v1.2.0", Assets: []Asset{
+			{Name: "app", URL: "app"},
+			{Name: "app" + MetadataExt, URL: "md"},
+			{Name: "app" + MetadataExt + signExt, URL: "md.msign"},
+		}}},
+		data: map[string][]byte{"md": data, "md.msign": testSign(t, priv, data)},
+	}
+
+	for _, downgrade := range []bool{false, true} {
+		u, err := New(WithSource(src), WithBinary("app"), WithCurrentVersion("v1.3.0-rc.1"), WithAllowDowngrade(downgrade),
+			WithKeyring(&Keyring{Keys: []TrustedKey{{ID: "release", Key: pub}}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := u.Check(context.Background())
+		if err != nil {
+			t.Fatalf("downgrade %v: unexpected error: %v", downgrade, err)
+		}
+		if res.Status != StatusOlder || res.Update != downgrade || res.Metadata == nil {
+			t.Errorf("downgrade %v: unexpected result %+v", downgrade, res)
+		}
+	}
+}
+
+func TestUpdaterCheckMissingMetadata(t *testing.T) {
+	src := &memSource{releases: []Release{{TagName: "v1.2.0", Assets: []Asset{{Name: "app", URL: "app"}}}}}
+
+	tests := []struct {
+		opts []Option
+		ok   bool
+	}{
+		{nil, true},
+		{[]Option{WithRequireMetadata(true)}, false},
+		{[]Option{WithThreshold(2)}, false},
+	}
+
+	for i, test := range tests {
+		u, err := New(append([]Option{WithSource(src), WithBinary("app"), WithCurrentVersion("v1.1.0")}, test.opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := u.Check(context.Background())
+		if test.ok && (err != nil || res.Metadata != nil) {
+			t.Errorf("%d: unexpected result %+v, %v", i, res, err)
+		}
+		if !test.ok && !errors.Is(err, ErrNotFound) {
+			t.Errorf("%d: expected not found error, got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"fmt"
+	"io"
+)
+
+// Phase is a stage of the update.
+type Phase string
+
+// Update phases reported to ProgressFunc.
+const (
+	PhaseFetchMetadata Phase = "fetch-metadata"
+	PhaseDownload      Phase = "download"
+	PhaseVerify        Phase = "verify"
+	PhaseInstall       Phase = "install"
+	PhaseHealthCheck   Phase = "health-check"
+)
+
+// Progress is reported at the start of a phase, while the phase is going
+// on (e.g. for every chunk of downloaded data) and at its end.
+type Progress struct {
+	Phase Phase
+	// Name is the asset (or release) the phase is applied to.
+	Name string
+	// Received is the number of received bytes, Total is the expected
+	// number of bytes, 0 if not known.
+	Received int64
+	Total    int64
+	Done     bool
+	// Err is set if the phase is done with error.
+	Err error
+}
+
+// ProgressFunc observes progress of the update.
+type ProgressFunc func(Progress)
+
+// LineProgress returns ProgressFunc writing a line to w for every phase,
+// e.g. "Downloading app... done".
+func LineProgress(w io.Writer) ProgressFunc {
+	return func(p Progress) {
+		switch {
+		case p.Done && p.Err != nil:
+			fmt.Fprintln(w, "failed")
+		case p.Done:
+			fmt.Fprintln(w, "done")
+		case p.Received == 0:
+			fmt.Fprintf(w, "%s... ", p.Title())
+		}
+	}
+}
+
+// Title returns human readable description of the phase.
+func (p Progress) Title() string {
+	switch p.Phase {
+	case PhaseFetchMetadata:
+		if p.Name != "" {
+			return fmt.Sprintf("Fetching release %s", p.Name)
+		}
+		return "Fetching release"
+	case PhaseDownload:
+		return fmt.Sprintf("Downloading %s", p.Name)
+	case PhaseVerify:
+		return fmt.Sprintf("Verifying %s", p.Name)
+	case PhaseInstall:
+		return fmt.Sprintf("Installing %s", p.Name)
+	case PhaseHealthCheck:
+		return fmt.Sprintf("Checking %s", p.Name)
+	}
+
+	return string(p.Phase)
+}
+
+func (f ProgressFunc) report(p Progress) {
+	if f != nil {
+		f(p)
+	}
+}
+
+// start reports the start of the phase and returns the function reporting
+// its end.
+func (f ProgressFunc) start(phase Phase, name string, total int64) func(err error) {
+	f.report(Progress{Phase: phase, Name: name, Total: total})
+	return func(err error) {
+		p := Progress{Phase: phase, Name: name, Total: total, Done: true, Err: err}
+		if err == nil {
+			p.Received = total
+		}
+		f.report(p)
+	}
+}
+
+// progressWriter reports the number of bytes written through it.
+type progressWriter struct {
+	report ProgressFunc
+	p      Progress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.p.Received += int64(len(b))
+	w.report.report(w.p)
+	return len(b), nil
+}
@@ -0,0 +1,60 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadProgress(t *testing.T) {
+	data := bytes.Repeat([]byte("binary content "), 10000)
+	src := &memSource{data: map[string][]byte{"app": data}}
+	asset := Asset{Name: "app", URL: "app", Size: int64(len(data))}
+
+	var events []Progress
+	progress := ProgressFunc(func(p Progress) {
+		events = append(events, p)
+	})
+
+	done := progress.start(PhaseDownload, asset.Name, asset.Size)
+	err := downloadAssetFile(context.Background(), src, asset, filepath.Join(t.TempDir(), "app"), 0755, progress)
+	done(err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) < 3 {
+		t.Fatalf("expected start, progress and done events, got %v", events)
+	}
+	if first := events[0]; first.Done || first.Received != 0 || first.Total != asset.Size {
+		t.Errorf("unexpected start event %+v", first)
+	}
+	for i := 1; i < len(events)-1; i++ {
+		if events[i].Received <= events[i-1].Received || events[i].Done {
+			t.Errorf("unexpected progress event %+v", events[i])
+		}
+	}
+	if last := events[len(events)-1]; !last.Done || last.Err != nil || last.Received != asset.Size {
+		t.Errorf("unexpected done event %+v", last)
+	}
+}
+
+func TestLineProgress(t *testing.T) {
+	var buf bytes.Buffer
+	progress := LineProgress(&buf)
+
+	progress.start(PhaseVerify, "app", 0)(nil)
+	done := progress.start(PhaseDownload, "app", 10)
+	progress(Progress{Phase: PhaseDownload, Name: "app", Received: 5, Total: 10})
+	done(errors.New("broken"))
+
+	expected := "Verifying app... done\nDownloading app... failed\n"
+	if buf.String() != expected {
+		t.Errorf("got %q, expected %q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"fmt"
+	"os"
+)
+
+// Restart replaces the running process with the current version of its
+// executable, e.g. just updated one, keeping the original arguments and
+// environment. prepare, if set, is called before the switch to flush the
+// state of the application, the restart is cancelled if it fails.
+// Restart returns only on error.
+func Restart(prepare func() error) error {
+	executable, err := executablePath()
+	if err != nil {
+		return err
+	}
+
+	return restart(executable, prepare)
+}
+
+// restart runs prepare and re-executes executable in place of the running
+// process.
+func restart(executable string, prepare func() error) error {
+	if prepare != nil {
+		if err := prepare(); err != nil {
+			return fmt.Errorf("restart is cancelled: %w", err)
+		}
+	}
+
+	if err := execve(executable, os.Args, os.Environ()); err != nil {
+		return fmt.Errorf("restart of %s failed: %w", executable, err)
+	}
+
+	return nil
+}
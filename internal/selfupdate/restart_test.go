@@ -0,0 +1,23 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestartCancelled(t *testing.T) {
+	errFlush := errors.New("flush failed")
+	executable := filepath.Join(t.TempDir(), "missing")
+
+	if err := restart(executable, func() error { return errFlush }); !errors.Is(err, errFlush) {
+		t.Errorf("expected prepare error, got %v", err)
+	}
+
+	if err := restart(executable, nil); err == nil {
+		t.Error("expected error for missing executable")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build selfupdate && !windows
+// +build selfupdate,!windows
+
+package selfupdate
+
+import (
+	"syscall"
+)
+
+// execve replaces the running process with executable.
+func execve(executable string, args []string, env []string) error {
+	return syscall.Exec(executable, args, env)
+}
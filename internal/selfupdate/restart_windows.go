@@ -0,0 +1,33 @@
+//go:build selfupdate && windows
+// +build selfupdate,windows
+
+package selfupdate
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// execve runs executable in place of the running process. Windows has no
+// exec(2), so the process waits for the started one and exits with its code.
+func execve(executable string, args []string, env []string) error {
+	cmd := exec.Command(executable, args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		os.Exit(exitErr.ExitCode())
+	case err != nil:
+		return err
+	}
+
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,19 @@
+package selfupdate
+
+// RevocationsName is the file name of the revocation list. It is published
+// as an asset of a release, the list of the newest release having one is
+// used. The list is signed with msign like the binaries.
+const RevocationsName = "revoked.json"
+
+// Revocations is the signed list of revoked releases.
+type Revocations struct {
+	Releases []Revocation `json:"releases"`
+}
+
+// Revocation describes a revoked release version or binary, by its SHA-256
+// digest.
+type Revocation struct {
+	Version string `json:"version,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
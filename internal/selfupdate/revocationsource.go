@@ -0,0 +1,121 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// revocationsTTL limits the age of the cached revocation list, so periodic
+// checks do not download it every time.
+const revocationsTTL = time.Hour
+
+// revocations returns the revocation list cached by the updater, it is
+// fetched again if it is older than revocationsTTL. Failed fetches are not
+// cached.
+func (u *Updater) revocations(ctx context.Context) (*Revocations, error) {
+	u.revocationsMu.Lock()
+	defer u.revocationsMu.Unlock()
+
+	if !u.revocationsAt.IsZero() && time.Since(u.revocationsAt) < revocationsTTL {
+		return u.revocationsList, nil
+	}
+
+	revocations, err := u.fetchRevocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	u.revocationsList, u.revocationsAt = revocations, time.Now()
+	return revocations, nil
+}
+
+// fetchRevocations downloads the revocation list of the newest release
+// having one and verifies its signatures. It returns nil if there is no
+// list.
+func (u *Updater) fetchRevocations(ctx context.Context) (*Revocations, error) {
+	releases, err := u.source.ListReleases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var release Release
+	var asset Asset
+	for _, r := range releases {
+		if r.Draft || (asset.Name != "" && !newerRelease(r, release)) {
+			continue
+		}
+
+		for _, a := range r.Assets {
+			if a.Name == RevocationsName {
+				release, asset = r, a
+			}
+		}
+	}
+
+	if asset.Name == "" {
+		return nil, nil
+	}
+
+	signs, err := u.downloadSignatures(ctx, signatureAssets(release.Assets, asset.Name, u.keyring))
+	if err != nil {
+		return nil, fmt.Errorf("revocations: %w", err)
+	}
+
+	done := u.progress.start(PhaseDownload, asset.Name, asset.Size)
+	data, err := downloadAsset(ctx, u.source, asset)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("revocations: %w", err)
+	}
+
+	done = u.progress.start(PhaseVerify, asset.Name, 0)
+	_, err = verifySignaturesData(u.keyring, u.threshold(), data, signs)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("revocations: %w", err)
+	}
+
+	revocations := &Revocations{}
+	if err = json.Unmarshal(data, revocations); err != nil {
+		return nil, fmt.Errorf("revocations: %w", err)
+	}
+
+	return revocations, nil
+}
+
+// find returns the revocation of the release version or the binary digest,
+// nil if it is not revoked. Empty version or digest is not looked up.
+func (r *Revocations) find(version string, sha256 string) *Revocation {
+	if r == nil {
+		return nil
+	}
+
+	for i, revoked := range r.Releases {
+		if version != "" && revoked.Version != "" {
+			if c, ok := compareVersions(revoked.Version, version); revoked.Version == version || (ok && c == 0) {
+				return &r.Releases[i]
+			}
+		}
+
+		if sha256 != "" && revoked.SHA256 != "" && strings.EqualFold(revoked.SHA256, sha256) {
+			return &r.Releases[i]
+		}
+	}
+
+	return nil
+}
+
+// revoked returns RevokedError if the release version or the binary digest
+// is revoked.
+func (r *Revocations) revoked(version string, sha256 string) error {
+	if revoked := r.find(version, sha256); revoked != nil {
+		return &RevokedError{Version: version, Reason: revoked.Reason}
+	}
+	return nil
+}
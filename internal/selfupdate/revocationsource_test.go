@@ -0,0 +1,92 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRevocations(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	revocations := &Revocations{Releases: []Revocation{
+		{Version: "v1.1.0", Reason: "broken migration"},
+		{SHA256: strings.ToUpper(sum)},
+	}}
+
+	tests := []struct {
+		version string
+		sha256  string
+		revoked bool
+	}{
+		{"v1.1.0", "", true},
+		{"1.1.0", "", true},
+		{"v1.2.0", "", false},
+		{"v1.2.0", sum, true},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		if revoked := revocations.find(test.version, test.sha256) != nil; revoked != test.revoked {
+			t.Errorf("%s %s: got revoked %v, expected %v", test.version, test.sha256, revoked, test.revoked)
+		}
+	}
+
+	var revokedErr *RevokedError
+	if err := revocations.revoked("v1.1.0", ""); !errors.As(err, &revokedErr) || revokedErr.Reason != "broken migration" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if (*Revocations)(nil).find("v1.1.0", sum) != nil {
+		t.Error("expected no revocations in nil list")
+	}
+}
+
+func TestUpdaterRevocations(t *testing.T) {
+	priv, pub := testKey(t)
+	data, err := json.Marshal(Revocations{Releases: []Revocation{{Version: "v1.1.0"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &memSource{
+		releases: []Release{{TagName: "v1.2.0", Assets: []Asset{
+			{Name: RevocationsName, URL: "revoked"},
+			{Name: RevocationsName + signExt, URL: "revoked.msign"},
+		}}},
+		data: map[string][]byte{"revoked": data, "revoked.msign": testSign(t, priv, data)},
+	}
+
+	u, err := New(WithSource(src), WithBinary("app"), WithCurrentVersion("v1.1.0"), WithPublicKeys(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := u.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.CurrentRevoked == nil {
+		t.Errorf("expected revoked current version, got %+v", res)
+	}
+
+	// The cached list is used by next checks
+	delete(src.data, "revoked")
+	if res, err = u.Check(context.Background()); err != nil || res.CurrentRevoked == nil {
+		t.Errorf("expected revoked current version, got %+v, %v", res, err)
+	}
+
+	// The check does not fail without the list, the install does
+	u.revocationsAt = time.Now().Add(-revocationsTTL)
+	if res, err = u.Check(context.Background()); err != nil || res.CurrentRevoked != nil {
+		t.Errorf("unexpected result %+v, %v", res, err)
+	}
+	if _, err = u.Apply(context.Background()); err == nil {
+		t.Error("expected error for missing revocation list")
+	}
+}
@@ -6,348 +6,188 @@ package selfupdate
 import (
 	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
-	"path"
-	"path/filepath"
-	"regexp"
 	"strings"
-	"time"
 
 	"github.com/m-sign/msign"
 )
 
-// Release collects data about a single release on GitHub.
-type Release struct {
-	Name        string    `json:"name"`
-	TagName     string    `json:"tag_name"`
-	Draft       bool      `json:"draft"`
-	PreRelease  bool      `json:"prerelease"`
-	PublishedAt time.Time `json:"published_at"`
-	Assets      []Asset   `json:"assets"`
-}
-
-// Asset is a file uploaded and attached to a release.
-type Asset struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-	URL  string `json:"url"`
-}
-
-func (r Release) String() string {
-	return fmt.Sprintf("%v %v, %d assets",
-		r.TagName,
-		r.PublishedAt.Local().Format("2006-01-02 15:04:05"),
-		len(r.Assets))
-}
-
 const (
-	githubAPITimeout        = 30 * time.Second
-	gitRegex                = `^(https?|git)(:\/\/|@)([^\/:]+)[\/:]([^\/:]+)\/([^\/\.:]+)(|\.git)$`
-	githubDomain            = "github.com"
-	githubReleaseFormat     = "https://api.github.com/repos/%s/%s/releases/latest"
-	githubAssetFormat       = "https://api.github.com/repos/%s/%s/releases/assets/%d"
-	githubAPIAccept         = "application/vnd.github.v3+json"
-	githubAPIContent        = "application/json"
-	githubAPIAcceptBinaries = "application/octet-stream"
+	signExt = ".msign"
 )
 
 var (
 	// msignPublic is the public key of the msign keypair used to sign the binaries.
-	// It is used to verify the signature of the downloaded binary.
+	// It is used to verify the signature of the downloaded binary until a
+	// keyring is delivered by a release (see Keyring).
 	// It is not a secret and can be shared publicly.
-	// This value MUST be updated if the keypair is changed.
 	msignPublic = "PUB:ARi1u_Ij_5AStTTLT3JfYmVFgWOS4lGPvrtqEuVLsKnsOzbh5oHZ\n"
 )
 
-// githubError is returned by the GitHub API, e.g. for rate-limiting.
-type githubError struct {
-	Message string
+// GetLatestVersion returns the latest version of released binary in the
+// repository at giturl.
+func GetLatestVersion(giturl string) (string, error) {
+	return latestVersion(WithRepository(giturl))
 }
 
-// gitHubLatestRelease uses the GitHub API to get information about the latest
-// release of a repository.
-func githubLatestRelease(ctx context.Context, git string) (Release, error) {
-	re := regexp.MustCompile(gitRegex)
-	matches := re.FindStringSubmatch(git)
-	if len(matches) < 6 {
-		return Release{}, fmt.Errorf("invalid GitHub URL %q", git)
-	}
-
-	if matches[3] != githubDomain {
-		return Release{}, fmt.Errorf("invalid GitHub domain %q", matches[3])
-	}
-
-	owner := matches[4]
-	repo := matches[5]
-
-	ctx, cancel := context.WithTimeout(ctx, githubAPITimeout)
-	defer cancel()
-
-	url := fmt.Sprintf(githubReleaseFormat, owner, repo)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return Release{}, err
-	}
-
-	// pin API version 3
-	req.Header.Set("Accept", githubAPIAccept)
-
-	res, err := http.DefaultClient.Do(req.WithContext(ctx))
-	// If we got an error, and the context has been canceled,
-	// the context's error is probably more useful.
-	if err != nil {
-		select {
-		case <-ctx.Done():
-			err = ctx.Err()
-		default:
-		}
-		return Release{}, err
-	}
-
-	if res.StatusCode != http.StatusOK {
-		content := res.Header.Get("Content-Type")
-		if strings.Contains(content, githubAPIContent) {
-			// try to decode error message
-			var msg githubError
-			jerr := json.NewDecoder(res.Body).Decode(&msg)
-			if jerr == nil {
-				return Release{}, fmt.Errorf("unexpected status %v (%v) returned, message:\n  %v", res.StatusCode, res.Status, msg.Message)
-			}
-		}
-
-		_ = res.Body.Close()
-		return Release{}, fmt.Errorf("unexpected status %v (%v) returned", res.StatusCode, res.Status)
-	}
-
-	buf, err := io.ReadAll(res.Body)
-	if err != nil {
-		_ = res.Body.Close()
-		return Release{}, err
-	}
-
-	err = res.Body.Close()
-	if err != nil {
-		return Release{}, err
-	}
-
-	var release Release
-	err = json.Unmarshal(buf, &release)
-	if err != nil {
-		return Release{}, err
-	}
-
-	if release.TagName == "" {
-		return Release{}, errors.New("tag name for latest release is empty")
-	}
-
-	return release, nil
+// GetLatestVersionFrom returns the latest version of released binary in src
+// for the release channel.
+func GetLatestVersionFrom(src Source, channel string) (string, error) {
+	return latestVersion(WithSource(src), WithChannel(channel))
 }
 
-// githubDownloadAsset uses the GitHub API to download an asset
-func githubDownloadAsset(ctx context.Context, asset Asset) ([]byte, error) {
-	req, err := http.NewRequest(http.MethodGet, asset.URL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// request binary data
-	req.Header.Set("Accept", githubAPIAcceptBinaries)
+// DownloadLatestVersion downloads the latest version of released binary in
+// the repository at giturl. The progress is written to stdout.
+func DownloadLatestVersion(giturl string, binary string, currentRelease string) error {
+	return apply(
+		WithRepository(giturl),
+		WithBinary(binary),
+		WithCurrentVersion(currentRelease),
+		WithProgress(LineProgress(os.Stdout)),
+	)
+}
 
-	res, err := http.DefaultClient.Do(req.WithContext(ctx))
-	// If we got an error, and the context has been canceled,
-	// the context's error is probably more useful.
-	if err != nil {
-		select {
-		case <-ctx.Done():
-			err = ctx.Err()
-		default:
-		}
-		return nil, err
-	}
+// DownloadLatestVersionFrom downloads the latest version of released binary in src
+// for the release channel. Only strictly newer versions are installed, unless
+// allowDowngrade is set. The replaced binary is kept in store (the default
+// one if nil). The progress of the update is reported to progress, if set.
+func DownloadLatestVersionFrom(src Source, channel string, binary string, currentRelease string, allowDowngrade bool, store *BackupStore, progress ProgressFunc) error {
+	return apply(
+		WithSource(src),
+		WithChannel(channel),
+		WithBinary(binary),
+		WithCurrentVersion(currentRelease),
+		WithAllowDowngrade(allowDowngrade),
+		WithBackupStore(store),
+		WithProgress(progress),
+	)
+}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %v (%v) returned", res.StatusCode, res.Status)
-	}
+// DownloadVersion downloads the released binary with the given version
+// (tag) in the repository at giturl.
+func DownloadVersion(giturl string, version string, binary string, currentRelease string, allowDowngrade bool) error {
+	return apply(
+		WithRepository(giturl),
+		WithVersion(version),
+		WithBinary(binary),
+		WithCurrentVersion(currentRelease),
+		WithAllowDowngrade(allowDowngrade),
+		WithProgress(LineProgress(os.Stdout)),
+	)
+}
 
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		_ = res.Body.Close()
-		return nil, err
-	}
+// DownloadVersionFrom downloads the released binary with the given version
+// (tag) in src. Versions older than the current one are installed only if
+// allowDowngrade is set. The replaced binary is kept in store (the default
+// one if nil). The progress of the update is reported to progress, if set.
+func DownloadVersionFrom(src Source, version string, binary string, currentRelease string, allowDowngrade bool, store *BackupStore, progress ProgressFunc) error {
+	return apply(
+		WithSource(src),
+		WithVersion(version),
+		WithBinary(binary),
+		WithCurrentVersion(currentRelease),
+		WithAllowDowngrade(allowDowngrade),
+		WithBackupStore(store),
+		WithProgress(progress),
+	)
+}
 
-	err = res.Body.Close()
+// latestVersion returns the tag of the update candidate of the updater
+// configured with opts.
+func latestVersion(opts ...Option) (string, error) {
+	u, err := New(opts...)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	return data, nil
-}
-
-// GetLatestVersion returns the latest version of released binary on GitHub.
-func GetLatestVersion(giturl string) (string, error) {
-	release, err := githubLatestRelease(context.Background(), giturl)
-
+	res, err := u.Check(context.Background())
 	if err != nil {
 		return "", err
 	}
 
-	return release.TagName, nil
+	return res.Candidate.TagName, nil
 }
 
-// DownloadLatestVersion downloads the latest version of released binary on GitHub.
-func DownloadLatestVersion(giturl string, binary string, currentRelease string) error {
-
-	// 1. Get current binary name and path
-	currentBinary, err := os.Executable()
+// apply installs the update of the updater configured with opts and prints
+// the result.
+func apply(opts ...Option) error {
+	u, err := New(opts...)
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
-	currentBinary = path.Clean(currentBinary)
-	if unlink, err := filepath.EvalSymlinks(currentBinary); err == nil {
-		currentBinary = unlink
-	}
 
-	// 2. Get latest version of released assets on GitHub
-	release, err := githubLatestRelease(context.Background(), giturl)
+	res, err := u.Apply(context.Background())
 	if err != nil {
 		return err
 	}
 
-	if release.TagName == currentRelease {
-		fmt.Printf("Already up to date: %v\n", release.TagName)
-		return nil
-	}
-
-	fmt.Printf("Update to latest release: %v\n", release.TagName)
-
-	// 3. Find binary and sign assets for current binary/OS/ARCH
-	binarySign := fmt.Sprintf("%s.msign", binary)
-
-	var binaryAsset Asset
-	var binarySignAsset Asset
-
-	for _, asset := range release.Assets {
-		if asset.Name == binary {
-			binaryAsset = asset
-		}
-		if asset.Name == binarySign {
-			binarySignAsset = asset
-		}
-	}
-
-	if binaryAsset.Name == "" {
-		return fmt.Errorf("binary asset %q not found", binary)
-	}
+	fmt.Println(res)
+	return nil
+}
 
-	if binarySignAsset.Name == "" {
-		return fmt.Errorf("binary sign asset %q not found", binarySign)
-	}
+// verifySignatureData checks msign signature sign of data with the trusted
+// keyring.
+func verifySignatureData(keyring *Keyring, data []byte, sign []byte) error {
+	return verifySignature(keyring, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}, sign)
+}
 
-	// 4. Download binary and sign assets
-	fmt.Printf("Downloading %s... ", binaryAsset.Name)
-	binaryData, err := githubDownloadAsset(context.Background(), binaryAsset)
-	if err != nil {
-		fmt.Println("failed")
-		return err
+// verifySignature checks msign signature sign of the content with any key
+// of the trusted keyring, the built-in one if keyring is not set.
+func verifySignature(keyring *Keyring, content func() (io.ReadCloser, error), sign []byte) error {
+	if keyring == nil {
+		keyring = builtinKeyring()
 	}
-	fmt.Println("done")
 
-	fmt.Printf("Downloading %s... ", binarySignAsset.Name)
-	binarySignData, err := githubDownloadAsset(context.Background(), binarySignAsset)
+	sig, err := msign.ImportSignature(bytes.NewReader(sign))
 	if err != nil {
-		fmt.Println("failed")
-		return err
+		return &SignatureError{Err: err}
 	}
-	fmt.Println("done")
-
-	// 5. Verify signature
-	fmt.Printf("Verifying %s... ", binaryAsset.Name)
 
-	pub, err := msign.ImportPublicKey(strings.NewReader(msignPublic))
-	if err != nil {
-		fmt.Println("failed")
-		return err
-	}
+	for _, key := range keyring.Keys {
+		valid, err := verifyKey(key, content, sig)
+		if err != nil {
+			return err
+		}
 
-	sig, err := msign.ImportSignature(bytes.NewReader(binarySignData))
-	if err != nil {
-		fmt.Println("failed")
-		return err
+		if valid {
+			return nil
+		}
 	}
 
-	valid, err := pub.Verify(bytes.NewReader(binaryData), sig)
+	return &SignatureError{}
+}
 
+// verifyKey checks msign signature sig of the content with key. It returns
+// false if the signature is made by another key.
+func verifyKey(key TrustedKey, content func() (io.ReadCloser, error), sig msign.Signature) (bool, error) {
+	pub, err := msign.ImportPublicKey(strings.NewReader(publicKey(key.Key)))
 	if err != nil {
-		fmt.Println("failed")
-		return err
-	}
-
-	if !valid {
-		fmt.Println("failed")
-		return errors.New("signature verification failed")
+		return false, err
 	}
 
-	fmt.Println("done")
-	// 6. Replace current binary with downloaded binary
-	// 6.1. Save current binary to new name
-
-	//create new file
-	fmt.Printf("Saving downloaded update... ")
-	newBinary := currentBinary + ".new"
-	newBinaryFile, err := os.Create(newBinary)
-	if err != nil {
-		fmt.Println("failed")
-		return err
-	}
-	_, err = newBinaryFile.Write(binaryData)
-	newBinaryFile.Close()
-	if err != nil {
-		fmt.Println("failed")
-		os.Remove(newBinary) // clean up
-		return err
+	if !bytes.Equal(pub.Id(), sig.KeyId()) {
+		return false, nil // not this key
 	}
 
-	//copy permissions
-	info, err := os.Stat(currentBinary)
+	data, err := content()
 	if err != nil {
-		fmt.Println("failed")
-		os.Remove(newBinary) // clean up
-		return err
+		return false, err
 	}
+	defer data.Close()
 
-	err = os.Chmod(newBinary, info.Mode())
-	if err != nil {
-		fmt.Println("failed")
-		os.Remove(newBinary) // clean up
-		return err
-	}
-	fmt.Println("done")
+	return pub.Verify(data, sig)
+}
 
-	// 6.2. Rename old binary to backup name
-	fmt.Printf("Updating... ")
-	err = os.Rename(currentBinary, currentBinary+".bak")
-	if err != nil {
-		fmt.Println("failed")
-		os.Remove(newBinary) // clean up
-		return err
+// publicKey returns the key terminated with newline.
+func publicKey(key string) string {
+	if !strings.HasSuffix(key, "\n") {
+		key += "\n"
 	}
-	// 6.3. Rename new binary to old binary name
-	err = os.Rename(newBinary, currentBinary)
-	if err != nil {
-		fmt.Println("failed")
-		os.Rename(currentBinary+".bak", currentBinary) // revert backup
-		return err
-	}
-
-	fmt.Println("done")
-
-	return nil
+	return key
 }
 
 func init() {
@@ -0,0 +1,147 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/m-sign/msign"
+)
+
+// Verification reports the trusted keys that signed the release asset.
+type Verification struct {
+	// Threshold is the required number of signed keys.
+	Threshold int
+	// Signed and Missing list identifiers of the keys in keyring order.
+	Signed  []string
+	Missing []string
+}
+
+// signatureAssets returns msign signature assets of name by the key
+// identifier: <name>.<keyid>.msign for keys of the keyring and
+// <name>.msign, signed by any trusted key, with empty identifier.
+func signatureAssets(assets []Asset, name string, keyring *Keyring) map[string]Asset {
+	signs := map[string]Asset{}
+	for _, asset := range assets {
+		if asset.Name == name+signExt {
+			signs[""] = asset
+			continue
+		}
+
+		for _, key := range keyring.Keys {
+			if asset.Name == name+"."+key.ID+signExt {
+				signs[key.ID] = asset
+			}
+		}
+	}
+	return signs
+}
+
+// downloadSignatures downloads signature assets.
+func (u *Updater) downloadSignatures(ctx context.Context, assets map[string]Asset) (map[string][]byte, error) {
+	signs := make(map[string][]byte, len(assets))
+	for id, asset := range assets {
+		done := u.progress.start(PhaseDownload, asset.Name, asset.Size)
+		sign, err := downloadAsset(ctx, u.source, asset)
+		done(err)
+		if err != nil {
+			return nil, err
+		}
+		signs[id] = sign
+	}
+	return signs, nil
+}
+
+// verifySignaturesFile checks msign signatures of file, see verifySignatures.
+func verifySignaturesFile(keyring *Keyring, threshold int, file string, signs map[string][]byte) (*Verification, error) {
+	return verifySignatures(keyring, threshold, func() (io.ReadCloser, error) {
+		return os.Open(file)
+	}, signs)
+}
+
+// verifySignaturesData checks msign signatures of data, see verifySignatures.
+func verifySignaturesData(keyring *Keyring, threshold int, data []byte, signs map[string][]byte) (*Verification, error) {
+	return verifySignatures(keyring, threshold, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}, signs)
+}
+
+// verifySignatures checks that the content is signed by at least threshold
+// keys of the keyring. signs are msign signatures by the key identifier,
+// the signature with empty identifier is accounted for any trusted key that
+// has not signed yet. Invalid signature of a trusted key is an error.
+func verifySignatures(keyring *Keyring, threshold int, content func() (io.ReadCloser, error), signs map[string][]byte) (*Verification, error) {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	// signed keys are counted by the key identifiers of signatures, so a key
+	// configured twice does not count twice to the threshold
+	signed := map[string]bool{}
+	signers := map[string]bool{}
+	for _, key := range keyring.Keys {
+		sign, ok := signs[key.ID]
+		if !ok {
+			continue
+		}
+
+		sig, err := msign.ImportSignature(bytes.NewReader(sign))
+		if err != nil {
+			return nil, &SignatureError{Key: key.ID, Err: err}
+		}
+
+		valid, err := verifyKey(key, content, sig)
+		if err != nil {
+			return nil, fmt.Errorf("signature of key %q: %w", key.ID, err)
+		}
+		if !valid {
+			return nil, &SignatureError{Key: key.ID}
+		}
+		if !signers[string(sig.KeyId())] {
+			signers[string(sig.KeyId())] = true
+			signed[key.ID] = true
+		}
+	}
+
+	if sign, ok := signs[""]; ok {
+		sig, err := msign.ImportSignature(bytes.NewReader(sign))
+		if err != nil {
+			return nil, &SignatureError{Err: err}
+		}
+
+		for _, key := range keyring.Keys {
+			if signed[key.ID] || signers[string(sig.KeyId())] {
+				continue
+			}
+
+			valid, err := verifyKey(key, content, sig)
+			if err != nil {
+				return nil, err
+			}
+			if valid {
+				signers[string(sig.KeyId())] = true
+				signed[key.ID] = true
+			}
+		}
+	}
+
+	res := &Verification{Threshold: threshold}
+	for _, key := range keyring.Keys {
+		if signed[key.ID] {
+			res.Signed = append(res.Signed, key.ID)
+		} else {
+			res.Missing = append(res.Missing, key.ID)
+		}
+	}
+
+	if len(res.Signed) < threshold {
+		return res, &ThresholdError{Verification: *res}
+	}
+
+	return res, nil
+}
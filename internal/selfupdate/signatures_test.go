@@ -0,0 +1,123 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSignatureAssets(t *testing.T) {
+	keyring := &Keyring{Keys: []TrustedKey{{ID: "ci", Key: msignPublic}, {ID: "release", Key: msignPublic}}}
+	assets := []Asset{
+		{Name: "app"},
+		{Name: "app.msign"},
+		{Name: "app.ci.msign"},
+		{Name: "app.other.msign"},
+		{Name: "app-linux.ci.msign"},
+	}
+
+	signs := signatureAssets(assets, "app", keyring)
+	if len(signs) != 2 || signs[""].Name != "app.msign" || signs["ci"].Name != "app.ci.msign" {
+		t.Errorf("unexpected signature assets %v", signs)
+	}
+}
+
+func TestVerifySignaturesThreshold(t *testing.T) {
+	keyring := &Keyring{Threshold: 2, Keys: []TrustedKey{{ID: "ci", Key: msignPublic}, {ID: "release", Key: msignPublic}}}
+
+	res, err := verifySignaturesData(keyring, keyring.Threshold, []byte("binary"), nil)
+
+	var thresholdErr *ThresholdError
+	if !errors.As(err, &thresholdErr) {
+		t.Fatalf("expected threshold error, got %v", err)
+	}
+	if res.Threshold != 2 || len(res.Signed) != 0 || len(res.Missing) != 2 || res.Missing[0] != "ci" {
+		t.Errorf("unexpected verification %+v", res)
+	}
+	if msg := err.Error(); msg != "signed by 0 of 2 required keys, missing: ci, release" {
+		t.Errorf("unexpected error message %q", msg)
+	}
+}
+
+func TestVerifySignaturesSecondKey(t *testing.T) {
+	oldPriv, oldKey := testKey(t)
+	newPriv, newKey := testKey(t)
+	keyring := &Keyring{Keys: []TrustedKey{{ID: "old", Key: oldKey}, {ID: "new", Key: newKey}}}
+	data := []byte("binary")
+
+	res, err := verifySignaturesData(keyring, 1, data, map[string][]byte{"": testSign(t, newPriv, data)})
+	if err != nil {
+		t.Fatalf("signature of the second key: %v", err)
+	}
+	if strings.Join(res.Signed, ",") != "new" || strings.Join(res.Missing, ",") != "old" {
+		t.Errorf("unexpected verification %+v", res)
+	}
+
+	res, err = verifySignaturesData(keyring, 2, data, map[string][]byte{"": testSign(t, newPriv, data), "old": testSign(t, oldPriv, data)})
+	if err != nil {
+		t.Fatalf("signatures of both keys: %v", err)
+	}
+	if strings.Join(res.Signed, ",") != "old,new" {
+		t.Errorf("unexpected verification %+v", res)
+	}
+
+	if _, err = verifySignaturesData(keyring, 1, data, map[string][]byte{"old": testSign(t, newPriv, data)}); err == nil {
+		t.Error("expected error for signature of another key")
+	}
+}
+
+func TestVerifySignaturesDuplicateKey(t *testing.T) {
+	priv, key := testKey(t)
+	keyring := &Keyring{Threshold: 2, Keys: []TrustedKey{{ID: "a", Key: key}, {ID: "b", Key: key}}}
+	data := []byte("binary")
+
+	for _, signs := range []map[string][]byte{
+		{"": testSign(t, priv, data)},
+		{"a": testSign(t, priv, data), "b": testSign(t, priv, data)},
+	} {
+		res, err := verifySignaturesData(keyring, keyring.Threshold, data, signs)
+
+		var thresholdErr *ThresholdError
+		if !errors.As(err, &thresholdErr) {
+			t.Fatalf("expected threshold error, got %v", err)
+		}
+		if strings.Join(res.Signed, ",") != "a" || strings.Join(res.Missing, ",") != "b" {
+			t.Errorf("unexpected verification %+v", res)
+		}
+	}
+}
+
+func TestVerifySignatureErrors(t *testing.T) {
+	priv, key := testKey(t)
+	otherPriv, _ := testKey(t)
+	keyring := &Keyring{Keys: []TrustedKey{{ID: "release", Key: key}}}
+	data := []byte("binary")
+
+	tests := []struct {
+		name  string
+		signs map[string][]byte
+		key   string
+	}{
+		{"malformed", map[string][]byte{"": []byte("not a signature")}, ""},
+		{"malformed key", map[string][]byte{"release": []byte("not a signature")}, "release"},
+		{"tampered key", map[string][]byte{"release": testSign(t, priv, []byte("tampered"))}, "release"},
+		{"other key", map[string][]byte{"release": testSign(t, otherPriv, data)}, "release"},
+	}
+
+	for _, test := range tests {
+		_, err := verifySignaturesData(keyring, 1, data, test.signs)
+
+		var signatureErr *SignatureError
+		if !errors.As(err, &signatureErr) || signatureErr.Key != test.key {
+			t.Errorf("%s: expected signature error, got %v", test.name, err)
+		}
+	}
+
+	var signatureErr *SignatureError
+	if err := verifySignatureData(keyring, data, testSign(t, otherPriv, data)); !errors.As(err, &signatureErr) {
+		t.Errorf("expected signature error for untrusted key, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Names of the supported release providers.
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+// Release collects data about a single release, independently of the
+// source it was obtained from.
+type Release struct {
+	Name        string
+	TagName     string
+	Draft       bool
+	PreRelease  bool
+	PublishedAt time.Time
+	Assets      []Asset
+}
+
+// Asset is a file attached to a release. Size and SHA256 (hex encoded
+// digest) are optional and checked on download when provided.
+type Asset struct {
+	Name   string
+	URL    string
+	Size   int64
+	SHA256 string
+}
+
+func (r Release) String() string {
+	return fmt.Sprintf("%v %v, %d assets",
+		r.TagName,
+		r.PublishedAt.Local().Format("2006-01-02 15:04:05"),
+		len(r.Assets))
+}
+
+// Source provides information about releases and access to their assets.
+// GitHub releases is one of the implementations.
+type Source interface {
+	// LatestRelease returns the latest published release.
+	LatestRelease(ctx context.Context) (Release, error)
+	// ReleaseByTag returns the release with the given tag name.
+	ReleaseByTag(ctx context.Context, tag string) (Release, error)
+	// ListReleases returns available releases, newest first.
+	ListReleases(ctx context.Context) ([]Release, error)
+	// OpenAsset opens a stream with the content of the asset.
+	// The caller is responsible for closing it.
+	OpenAsset(ctx context.Context, asset Asset) (io.ReadCloser, error)
+}
+
+// RangeSource is a Source able to resume interrupted asset downloads.
+type RangeSource interface {
+	Source
+	// OpenAssetRange opens a stream with the content of the asset from
+	// offset, if the asset is not changed since etag was received. Otherwise
+	// the whole content is returned. The caller is responsible for closing
+	// the stream.
+	OpenAssetRange(ctx context.Context, asset Asset, offset int64, etag string) (AssetRange, error)
+}
+
+// AssetRange is a stream with the content of the asset from Offset.
+type AssetRange struct {
+	Body   io.ReadCloser
+	Offset int64
+	// ETag identifies the asset content, empty if the download
+	// can not be resumed.
+	ETag string
+}
+
+// DetectProvider guesses the release provider from the repository host of
+// giturl: hosts mentioning "gitlab" are GitLab ones, everything else is
+// treated as GitHub or GitHub Enterprise Server.
+func DetectProvider(giturl string) string {
+	re := regexp.MustCompile(gitlabRegex)
+	matches := re.FindStringSubmatch(giturl)
+	if len(matches) > 3 && strings.Contains(strings.ToLower(matches[3]), ProviderGitLab) {
+		return ProviderGitLab
+	}
+	return ProviderGitHub
+}
+
+// NewSource returns a source for the repository at giturl, with the
+// provider detected by DetectProvider.
+func NewSource(giturl string) (Source, error) {
+	if DetectProvider(giturl) == ProviderGitLab {
+		src, err := NewGitLabSource(giturl)
+		if err != nil {
+			return nil, err
+		}
+		return src, nil
+	}
+
+	src, err := NewGitHubSource(giturl)
+	if err != nil {
+		return nil, err
+	}
+	return src, nil
+}
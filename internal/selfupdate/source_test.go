@@ -0,0 +1,139 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-sign/msign"
+)
+
+// memSource is an in-memory Source used in tests. Asset URLs are keys of
+// the data map.
+type memSource struct {
+	releases []Release
+	data     map[string][]byte
+}
+
+func (s *memSource) LatestRelease(ctx context.Context) (Release, error) {
+	for _, release := range s.releases {
+		if !release.Draft && !release.PreRelease {
+			return release, nil
+		}
+	}
+	return Release{}, fmt.Errorf("no releases")
+}
+
+func (s *memSource) ReleaseByTag(ctx context.Context, tag string) (Release, error) {
+	for _, release := range s.releases {
+		if release.TagName == tag {
+			return release, nil
+		}
+	}
+	return Release{}, fmt.Errorf("release %q not found", tag)
+}
+
+func (s *memSource) ListReleases(ctx context.Context) ([]Release, error) {
+	return s.releases, nil
+}
+
+func (s *memSource) OpenAsset(ctx context.Context, asset Asset) (io.ReadCloser, error) {
+	data, ok := s.data[asset.URL]
+	if !ok {
+		return nil, fmt.Errorf("asset %q not found", asset.URL)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// testKey generates msign keypair and returns the private key and exported
+// public key.
+func testKey(t *testing.T) (msign.PrivateKey, string) {
+	t.Helper()
+
+	priv, pub, err := msign.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = msign.Export(&buf, pub); err != nil {
+		t.Fatal(err)
+	}
+
+	return priv, buf.String()
+}
+
+// testSign returns exported msign signature of data.
+func testSign(t *testing.T, priv msign.PrivateKey, data []byte) []byte {
+	t.Helper()
+
+	sig, err := priv.Sign(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = msign.Export(&buf, sig); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDownloadAssetDigest(t *testing.T) {
+	data := []byte("binary content")
+	sum := sha256.Sum256(data)
+	src := &memSource{data: map[string][]byte{"app": data}}
+
+	asset := Asset{Name: "app", URL: "app", Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+	if _, err := downloadAsset(context.Background(), src, asset); err != nil {
+		t.Fatal(err)
+	}
+
+	wrongSize := asset
+	wrongSize.Size++
+	if _, err := downloadAsset(context.Background(), src, wrongSize); err == nil {
+		t.Error("expected size mismatch error")
+	}
+
+	wrongDigest := asset
+	wrongDigest.SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+	if _, err := downloadAsset(context.Background(), src, wrongDigest); err == nil {
+		t.Error("expected digest mismatch error")
+	}
+}
+
+func TestDownloadAssetFile(t *testing.T) {
+	data := []byte("binary content")
+	src := &memSource{data: map[string][]byte{"app": data}}
+	file := filepath.Join(t.TempDir(), "app.new")
+
+	asset := Asset{Name: "app", URL: "app", Size: int64(len(data))}
+	if err := downloadAssetFile(context.Background(), src, asset, file, 0755, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cont, err := os.ReadFile(file); err != nil || !bytes.Equal(cont, data) {
+		t.Errorf("unexpected file content %q, %v", cont, err)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("unexpected file mode: %v, %v", info, err)
+	}
+
+	truncated := asset
+	truncated.Size -= 2
+	if err := downloadAssetFile(context.Background(), src, truncated, file, 0755, nil); err == nil {
+		t.Error("expected size limit error")
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("file is not removed on error")
+	}
+}
@@ -0,0 +1,788 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.melnyk.org/mlog"
+	"go.melnyk.org/mlog/nolog"
+)
+
+// Status of the candidate release relative to the current version.
+type Status string
+
+// Candidate release statuses.
+const (
+	StatusUpToDate      Status = "up-to-date"
+	StatusNewer         Status = "newer"
+	StatusOlder         Status = "older"
+	StatusNotComparable Status = "not-comparable"
+)
+
+// Action is taken by Updater.Apply.
+type Action string
+
+// Actions of the update.
+const (
+	ActionNone    Action = "none"
+	ActionUpdated Action = "updated"
+	ActionPlanned Action = "planned"
+)
+
+// CheckResult describes the candidate release for the update.
+type CheckResult struct {
+	Current   string
+	Candidate Release
+	Status    Status
+	// Update is set if the candidate is installed by Apply.
+	Update bool
+	// Binary and Signature are the candidate assets for the binary,
+	// empty if not found.
+	Binary    Asset
+	Signature Asset
+	// KeySignatures are the signature assets of the binary by the trusted
+	// key identifier (<binary>.<keyid>.msign).
+	KeySignatures map[string]Asset
+	// Checksums is the checksums asset of the release, empty if not found.
+	Checksums Asset
+	// Metadata is the verified release metadata of the binary, nil if
+	// the release has no metadata.
+	Metadata *Metadata
+	// Revoked and CurrentRevoked are the revocations of the candidate and
+	// the current version, nil if they are not revoked or the revocation
+	// list is not available.
+	Revoked        *Revocation
+	CurrentRevoked *Revocation
+
+	revocations    *Revocations
+	revocationsErr error
+}
+
+// ApplyResult describes the applied update.
+type ApplyResult struct {
+	CheckResult
+	Action Action
+	// Target is the path of the updated binary.
+	Target string
+	// Backup is the replaced binary kept in the backup store. It is nil
+	// if the backup is failed, the binary is left as <Target>.bak then.
+	Backup *Backup
+	// Plan lists file renames of the install planned by the dry run.
+	Plan []Rename
+	// Keyring is the trusted keyring delivered by the release, nil if
+	// the keyring is not changed.
+	Keyring *Keyring
+	// Verification reports the keys that signed the binary, or the
+	// checksums file if the binary signatures are not verified.
+	Verification *Verification
+}
+
+// Rename is a file rename step of the install.
+type Rename struct {
+	From string
+	To   string
+}
+
+func (r Rename) String() string {
+	return fmt.Sprintf("rename %s -> %s", r.From, r.To)
+}
+
+func (r *ApplyResult) String() string {
+	switch {
+	case r.Action == ActionUpdated:
+		return fmt.Sprintf("Updated to release: %v", r.Candidate.TagName)
+	case r.Action == ActionPlanned:
+		return fmt.Sprintf("Dry run, update to release %v is planned", r.Candidate.TagName)
+	case r.Revoked != nil:
+		return fmt.Sprintf("Release %v is revoked, update is skipped", r.Candidate.TagName)
+	case r.Status == StatusUpToDate:
+		return fmt.Sprintf("Already up to date: %v", r.Candidate.TagName)
+	case r.Status == StatusNotComparable:
+		return fmt.Sprintf("Can not compare current version %v with %v, downgrade is not allowed", r.Current, r.Candidate.TagName)
+	case r.Status == StatusOlder:
+		return fmt.Sprintf("Current version %v is newer than %v, downgrade is not allowed", r.Current, r.Candidate.TagName)
+	}
+
+	return string(r.Action)
+}
+
+// Updater checks and applies updates of a binary. It never writes to
+// stdout, the progress is reported to ProgressFunc and the details to
+// the logger.
+type Updater struct {
+	source          Source
+	giturl          string
+	client          *http.Client
+	keyring         *Keyring
+	keyringFile     string
+	minThreshold    int
+	verify          string
+	requireMetadata bool
+	target          string
+	binary          string
+	current         string
+	channel         string
+	version         string
+	allowDowngrade  bool
+	dryRun          bool
+	healthArgs      []string
+	healthTimeout   time.Duration
+	healthSince     string
+	restart         bool
+	prepare         func() error
+	store           *BackupStore
+	timeout         time.Duration
+	progress        ProgressFunc
+	log             mlog.Logger
+
+	// The revocation list is cached for revocationsTTL
+	revocationsMu   sync.Mutex
+	revocationsList *Revocations
+	revocationsAt   time.Time
+}
+
+// Option configures Updater.
+type Option func(*Updater)
+
+// WithSource sets the release source.
+func WithSource(src Source) Option {
+	return func(u *Updater) {
+		u.source = src
+	}
+}
+
+// WithRepository sets the release source for the repository at giturl.
+func WithRepository(giturl string) Option {
+	return func(u *Updater) {
+		u.giturl = giturl
+	}
+}
+
+// WithHTTPClient sets the client for the release source created for
+// the repository.
+func WithHTTPClient(client *http.Client) Option {
+	return func(u *Updater) {
+		u.client = client
+	}
+}
+
+// WithPublicKeys sets trusted msign public keys, see WithKeyring.
+func WithPublicKeys(keys ...string) Option {
+	return func(u *Updater) {
+		u.keyring = keyringOf(keys)
+	}
+}
+
+// WithKeyring sets the trusted keyring. It is used for ManifestSource
+// without own keyring too. By default the keyring is read from the keyring
+// file (the built-in key is used if it does not exist) and replaced with
+// the keyring delivered by the installed release.
+func WithKeyring(keyring *Keyring) Option {
+	return func(u *Updater) {
+		u.keyring = keyring
+	}
+}
+
+// WithKeyringFile sets the keyring file, .<name>.keyring.json next to the
+// target binary by default.
+func WithKeyringFile(file string) Option {
+	return func(u *Updater) {
+		u.keyringFile = file
+	}
+}
+
+// WithThreshold requires signatures of at least m trusted keys, the
+// threshold of the keyring is used if it is higher.
+func WithThreshold(m int) Option {
+	return func(u *Updater) {
+		u.minThreshold = m
+	}
+}
+
+// WithVerify sets the verify policy of the downloaded binary: VerifyMsign
+// (default), VerifyChecksum or VerifyBoth.
+func WithVerify(policy string) Option {
+	return func(u *Updater) {
+		u.verify = policy
+	}
+}
+
+// WithRequireMetadata makes the signed release metadata of the binary
+// (<binary>.metadata.json) required. The metadata is verified if the
+// release has it anyway, and it is always required if the signature
+// threshold is higher than 1.
+func WithRequireMetadata(require bool) Option {
+	return func(u *Updater) {
+		u.requireMetadata = require
+	}
+}
+
+// WithTarget sets the path of the updated binary, the running executable
+// by default.
+func WithTarget(path string) Option {
+	return func(u *Updater) {
+		u.target = path
+	}
+}
+
+// WithBinary sets the name of the binary asset in releases.
+func WithBinary(name string) Option {
+	return func(u *Updater) {
+		u.binary = name
+	}
+}
+
+// WithCurrentVersion sets the version of the installed binary.
+func WithCurrentVersion(version string) Option {
+	return func(u *Updater) {
+		u.current = version
+	}
+}
+
+// WithChannel sets the release channel, ChannelStable by default.
+func WithChannel(channel string) Option {
+	return func(u *Updater) {
+		u.channel = channel
+	}
+}
+
+// WithVersion pins the update to the release with the given version (tag)
+// instead of the latest one in the channel.
+func WithVersion(version string) Option {
+	return func(u *Updater) {
+		u.version = version
+	}
+}
+
+// WithAllowDowngrade allows to install older (or not comparable) versions
+// than the current one.
+func WithAllowDowngrade(allow bool) Option {
+	return func(u *Updater) {
+		u.allowDowngrade = allow
+	}
+}
+
+// WithDryRun makes Apply to download and verify the update, check that
+// the target binary could be replaced and report the planned steps without
+// touching the binary. The update is downloaded to a temporary directory.
+func WithDryRun(dryRun bool) Option {
+	return func(u *Updater) {
+		u.dryRun = dryRun
+	}
+}
+
+// WithHealthCheck makes Apply to run the installed binary with args and
+// restore the replaced binary if the installed one does not exit
+// successfully within timeout (DefaultHealthCheckTimeout if not set) or
+// reports other version than the installed release. The binary should
+// print its version, as plain text or as "version" field of JSON object.
+func WithHealthCheck(timeout time.Duration, args ...string) Option {
+	return func(u *Updater) {
+		u.healthTimeout = timeout
+		u.healthArgs = args
+	}
+}
+
+// WithHealthCheckSince skips the health check, with a warning, for releases
+// older than version, which predate the health check arguments of the binary.
+func WithHealthCheckSince(version string) Option {
+	return func(u *Updater) {
+		u.healthSince = version
+	}
+}
+
+// WithRestart makes Apply to re-execute the updated binary in place of the
+// running process with the original arguments and environment once the
+// update is installed. prepare, if set, is called before the switch to
+// flush the state of the application, the restart is cancelled if it fails.
+// The restart is skipped if the target is not the running executable.
+func WithRestart(prepare func() error) Option {
+	return func(u *Updater) {
+		u.restart = true
+		u.prepare = prepare
+	}
+}
+
+// WithBackupStore sets the store for backups of replaced binaries.
+func WithBackupStore(store *BackupStore) Option {
+	return func(u *Updater) {
+		u.store = store
+	}
+}
+
+// WithTimeout limits the duration of every operation.
+func WithTimeout(timeout time.Duration) Option {
+	return func(u *Updater) {
+		u.timeout = timeout
+	}
+}
+
+// WithProgress sets the observer of the update progress.
+func WithProgress(progress ProgressFunc) Option {
+	return func(u *Updater) {
+		u.progress = progress
+	}
+}
+
+// WithLogger sets the logger, nothing is logged by default.
+func WithLogger(log mlog.Logger) Option {
+	return func(u *Updater) {
+		u.log = log
+	}
+}
+
+// New returns Updater configured with opts.
+func New(opts ...Option) (*Updater, error) {
+	u := &Updater{
+		channel: ChannelStable,
+		verify:  VerifyMsign,
+		log:     nolog.NewLogbook().Joiner().Join("selfupdate"),
+	}
+
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	switch u.verify {
+	case VerifyMsign, VerifyChecksum, VerifyBoth:
+	default:
+		return nil, fmt.Errorf("unknown verify policy %q", u.verify)
+	}
+
+	if u.source == nil && u.giturl != "" {
+		src, err := NewSource(u.giturl)
+		if err != nil {
+			return nil, err
+		}
+
+		switch s := src.(type) {
+		case *GitHubSource:
+			s.Client = u.client
+		case *GitLabSource:
+			s.Client = u.client
+		}
+		u.source = src
+	}
+
+	if u.keyring == nil {
+		keyring, err := u.loadKeyring()
+		if err != nil {
+			return nil, err
+		}
+		u.keyring = keyring
+	} else {
+		u.keyringFile = ""
+	}
+
+	if s, ok := u.source.(*ManifestSource); ok && s.Keyring == nil {
+		s.Keyring = u.keyring
+	}
+
+	return u, nil
+}
+
+// Check returns the candidate release for the update.
+func (u *Updater) Check(ctx context.Context) (*CheckResult, error) {
+	ctx, cancel := u.context(ctx)
+	defer cancel()
+
+	return u.check(ctx)
+}
+
+// Apply installs the candidate release, if it is newer than the current
+// version (or downgrade is allowed) and not revoked, and keeps the replaced
+// binary in the backup store. RevokedError is returned for the revoked
+// release requested by WithVersion. Apply does not return if the restart is set and
+// succeeded.
+func (u *Updater) Apply(ctx context.Context) (*ApplyResult, error) {
+	ctx, cancel := u.context(ctx)
+	defer cancel()
+
+	if u.binary == "" {
+		return nil, errors.New("binary asset name is not set")
+	}
+
+	check, err := u.check(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The revocation list is optional for the check, but not for the install
+	if check.Update && check.revocationsErr != nil {
+		return nil, check.revocationsErr
+	}
+
+	res := &ApplyResult{CheckResult: *check, Action: ActionNone}
+	if res.Revoked != nil && u.version != "" {
+		return nil, &RevokedError{Version: res.Candidate.TagName, Reason: res.Revoked.Reason}
+	}
+
+	if !res.Update {
+		u.log.Info(res.String())
+		return res, nil
+	}
+
+	if res.Binary.Name == "" {
+		return nil, fmt.Errorf("binary asset %q %w", u.binary, ErrNotFound)
+	}
+
+	if u.verifyMsign() && res.Signature.Name == "" && len(res.KeySignatures) == 0 {
+		return nil, fmt.Errorf("binary sign asset %q %w", u.binary+signExt, ErrNotFound)
+	}
+
+	if u.verifyChecksum() && res.Checksums.Name == "" {
+		return nil, fmt.Errorf("checksums asset %q %w", checksumsAsset, ErrNotFound)
+	}
+
+	res.Target, err = u.targetPath()
+	if err != nil {
+		return nil, err
+	}
+
+	u.log.Info("Update to release: " + res.Candidate.TagName)
+	if err = u.install(ctx, res); err != nil {
+		return nil, err
+	}
+
+	u.log.Info(res.String())
+
+	if u.restart && res.Action == ActionUpdated {
+		// The update is already installed, so the result is returned with
+		// the error if the restart is failed
+		if executable, err := executablePath(); err != nil || executable != res.Target {
+			u.log.Warning("Restart is skipped, " + res.Target + " is not the running executable")
+			return res, nil
+		}
+
+		u.log.Info("Restart with release: " + res.Candidate.TagName)
+		return res, restart(res.Target, u.prepare)
+	}
+
+	return res, nil
+}
+
+func (u *Updater) check(ctx context.Context) (*CheckResult, error) {
+	if u.source == nil {
+		return nil, errors.New("release source is not set")
+	}
+
+	done := u.progress.start(PhaseFetchMetadata, u.version, 0)
+	release, err := u.release(ctx)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &CheckResult{Current: u.current, Candidate: release}
+	for _, asset := range release.Assets {
+		switch {
+		case isChecksums(asset):
+			res.Checksums = asset
+		case u.binary != "" && asset.Name == u.binary:
+			res.Binary = asset
+		}
+	}
+
+	if u.binary != "" {
+		signs := signatureAssets(release.Assets, u.binary, u.keyring)
+		res.Signature = signs[""]
+		delete(signs, "")
+		if len(signs) > 0 {
+			res.KeySignatures = signs
+		}
+	}
+
+	c, ok := compareVersions(release.TagName, u.current)
+	switch {
+	case release.TagName == u.current || (ok && c == 0):
+		res.Status = StatusUpToDate
+	case !ok:
+		res.Status = StatusNotComparable
+		res.Update = u.allowDowngrade
+	case c < 0:
+		res.Status = StatusOlder
+		res.Update = u.allowDowngrade
+	default:
+		res.Status = StatusNewer
+		res.Update = true
+	}
+
+	// Revoked releases are never installed
+	if res.revocations, err = u.revocations(ctx); err != nil {
+		u.log.Warning("Revocation list is not available: " + err.Error())
+		res.revocationsErr = err
+	}
+	res.Revoked = res.revocations.find(release.TagName, res.Binary.SHA256)
+	res.CurrentRevoked = res.revocations.find(u.current, "")
+	if res.Revoked != nil {
+		res.Update = false
+	}
+
+	// Metadata protects from stale and older releases served as the latest
+	if res.Binary.Name != "" {
+		if res.Metadata, err = u.releaseMetadata(ctx, res); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// release returns the pinned release or the latest one in the channel.
+func (u *Updater) release(ctx context.Context) (Release, error) {
+	if u.version != "" {
+		return u.source.ReleaseByTag(ctx, u.version)
+	}
+
+	return latestRelease(ctx, u.source, u.channel)
+}
+
+// install replaces the target binary with the binary asset of the candidate
+// release and keeps the replaced one in the backup store.
+func (u *Updater) install(ctx context.Context, res *ApplyResult) error {
+	info, err := os.Stat(res.Target)
+	if err != nil {
+		return err
+	}
+
+	// The dry run checks that the target could be replaced before the download
+	if u.dryRun {
+		if err = u.plan(res); err != nil {
+			return err
+		}
+	}
+
+	// 1. Verify checksums file, the binary digest of the checksums and the
+	// metadata is checked on download then
+	binary := res.Binary
+	if u.verifyChecksum() {
+		sum, verification, err := u.releaseChecksum(ctx, res.Candidate, res.Checksums, binary.Name)
+		if err != nil {
+			return err
+		}
+
+		if err = pinDigest(&binary, sum, res.Checksums.Name); err != nil {
+			return err
+		}
+		res.Verification = verification
+	}
+
+	if res.Metadata != nil {
+		if err = pinDigest(&binary, res.Metadata.SHA256, res.Binary.Name+MetadataExt); err != nil {
+			return err
+		}
+	}
+
+	// 2. Download sign assets and stream binary asset next to the target binary
+	var signs map[string][]byte
+	if u.verifyMsign() {
+		signs, err = u.downloadSignatures(ctx, signatureAssets(res.Candidate.Assets, u.binary, u.keyring))
+		if err != nil {
+			return err
+		}
+	}
+
+	// The dry run downloads to a temporary directory, so the partial download
+	// of an interrupted update next to the target is kept intact
+	newBinary := res.Target + newExt
+	if u.dryRun {
+		tmp, err := os.MkdirTemp("", "selfupdate-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp) // clean up
+		newBinary = filepath.Join(tmp, filepath.Base(res.Target))
+	}
+
+	done := u.progress.start(PhaseDownload, binary.Name, binary.Size)
+	err = downloadAssetFile(ctx, u.source, binary, newBinary, info.Mode(), u.progress)
+	done(err)
+	if err != nil {
+		return err
+	}
+
+	// 3. Verify signatures and refuse revoked binary
+	if u.verifyMsign() {
+		done = u.progress.start(PhaseVerify, binary.Name, 0)
+		res.Verification, err = verifySignaturesFile(u.keyring, u.threshold(), newBinary, signs)
+		done(err)
+		if err != nil {
+			os.Remove(newBinary) // clean up
+			return err
+		}
+	}
+
+	if res.revocations != nil {
+		sum, err := fileSHA256(newBinary)
+		if err == nil {
+			err = res.revocations.revoked(res.Candidate.TagName, sum)
+		}
+		if err != nil {
+			os.Remove(newBinary) // clean up
+			return err
+		}
+	}
+	u.log.Verbose("Signed by: " + strings.Join(res.Verification.Signed, ", "))
+
+	keyring, err := u.releaseKeyring(ctx, res.Candidate)
+	if err != nil {
+		os.Remove(newBinary) // clean up
+		return err
+	}
+
+	if u.dryRun {
+		return nil
+	}
+
+	// 4. Replace target binary with downloaded binary
+	done = u.progress.start(PhaseInstall, res.Candidate.TagName, 0)
+
+	// Keep the signatures of the current binary for rollback, if available
+	backup := Backup{Version: u.current, InstalledAt: info.ModTime()}
+	if signs, err := releaseSignatures(ctx, u.source, u.current, u.binary, u.keyring); err == nil {
+		backup.setSignatures(signs)
+	} else {
+		u.log.Verbose(fmt.Sprintf("Signature of %s is not available: %v", u.current, err))
+	}
+
+	err = replaceBinary(res.Target, newBinary)
+	done(err)
+	if err != nil {
+		return err
+	}
+
+	// 5. Run the new binary, restore the replaced one if it is not healthy
+	if len(u.healthArgs) > 0 && !u.healthCheckable(res.Candidate.TagName) {
+		u.log.Warning(fmt.Sprintf("Health check is skipped, %s predates %s", res.Candidate.TagName, u.healthSince))
+	} else if len(u.healthArgs) > 0 {
+		done = u.progress.start(PhaseHealthCheck, res.Candidate.TagName, 0)
+		err = healthCheck(ctx, res.Target, u.healthArgs, u.healthTimeout, res.Candidate.TagName)
+		done(err)
+		if err != nil {
+			u.log.Error(err.Error())
+			if rerr := os.Rename(res.Target+backupExt, res.Target); rerr != nil {
+				return fmt.Errorf("%w, restore of %s failed: %v", err, u.current, rerr)
+			}
+			u.log.Warning("Restored version: " + u.current)
+			return err
+		}
+	}
+
+	// 6. Trust the keyring delivered by the installed release
+	if keyring != nil {
+		if err = keyring.Save(u.keyringFile); err != nil {
+			u.log.Warning(fmt.Sprintf("Keyring is not saved to %s: %v", u.keyringFile, err))
+		} else {
+			u.keyring = keyring
+			res.Keyring = keyring
+			u.log.Info("Trusted keys: " + strings.Join(keyring.IDs(), ", "))
+		}
+	}
+
+	// 7. Move replaced binary to backups
+	// The update is already installed, so the backup is left in place on error
+	stored, err := u.store.add(res.Target, res.Target+backupExt, backup)
+	if err != nil {
+		u.log.Warning(fmt.Sprintf("Backup of %s is kept as %s: %v", u.current, res.Target+backupExt, err))
+		if err = keepLeftBackup(res.Target, backup); err != nil {
+			u.log.Warning(fmt.Sprintf("Backup info of %s is not saved: %v", u.current, err))
+		}
+	} else {
+		res.Backup = &stored
+	}
+
+	res.Action = ActionUpdated
+	return nil
+}
+
+// healthCheckable reports whether the release with version supports the
+// health check. Versions not comparable with healthSince are checked.
+func (u *Updater) healthCheckable(version string) bool {
+	if u.healthSince == "" {
+		return true
+	}
+
+	c, ok := compareVersions(version, u.healthSince)
+	return !ok || c >= 0
+}
+
+// verifyMsign reports whether msign signatures of the binary are verified.
+func (u *Updater) verifyMsign() bool {
+	return u.verify == VerifyMsign || u.verify == VerifyBoth
+}
+
+// verifyChecksum reports whether the binary digest is verified with the
+// checksums file.
+func (u *Updater) verifyChecksum() bool {
+	return u.verify == VerifyChecksum || u.verify == VerifyBoth
+}
+
+// threshold returns the number of keys required to sign a release.
+func (u *Updater) threshold() int {
+	if u.minThreshold > u.keyring.Threshold {
+		return u.minThreshold
+	}
+	return u.keyring.Threshold
+}
+
+// plan checks that the target binary could be replaced and reports the steps
+// of the install. It does not create the backup store.
+func (u *Updater) plan(res *ApplyResult) error {
+	if err := writable(res.Target); err != nil {
+		return err
+	}
+
+	if err := writable(filepath.Dir(res.Target)); err != nil {
+		return err
+	}
+
+	backup, err := u.store.path(res.Target, u.current)
+	if err != nil {
+		return err
+	}
+
+	res.Plan = []Rename{
+		{From: res.Target, To: res.Target + backupExt},
+		{From: res.Target + newExt, To: res.Target},
+		{From: res.Target + backupExt, To: backup},
+	}
+	res.Action = ActionPlanned
+
+	return nil
+}
+
+// targetPath returns the path of the updated binary with symlinks resolved.
+func (u *Updater) targetPath() (string, error) {
+	if u.target == "" {
+		return executablePath()
+	}
+
+	return resolvePath(u.target), nil
+}
+
+// context returns ctx limited by the updater timeout.
+func (u *Updater) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if u.timeout > 0 {
+		return context.WithTimeout(ctx, u.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// resolvePath returns the clean path with symlinks resolved, if possible.
+func resolvePath(path string) string {
+	path = filepath.Clean(path)
+	if unlink, err := filepath.EvalSymlinks(path); err == nil {
+		path = unlink
+	}
+	return path
+}
@@ -0,0 +1,282 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdaterCheck(t *testing.T) {
+	src := &memSource{releases: []Release{
+		{TagName: "v1.2.0", Assets: []Asset{{Name: "app"}, {Name: "app.msign"}}},
+	}}
+
+	tests := []struct {
+		current   string
+		downgrade bool
+		status    Status
+		update    bool
+	}{
+		{"v1.1.0", false, StatusNewer, true},
+		{"v1.2.0", false, StatusUpToDate, false},
+		{"1.2.0", false, StatusUpToDate, false},
+		{"v1.3.0", false, StatusOlder, false},
+		{"v1.3.0", true, StatusOlder, true},
+		{"dev", false, StatusNotComparable, false},
+		{"dev", true, StatusNotComparable, true},
+	}
+
+	for _, test := range tests {
+		u, err := New(WithSource(src), WithBinary("app"), WithCurrentVersion(test.current), WithAllowDowngrade(test.downgrade))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := u.Check(context.Background())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.current, err)
+		}
+		if res.Status != test.status || res.Update != test.update {
+			t.Errorf("%s: got %v/%v, expected %v/%v", test.current, res.Status, res.Update, test.status, test.update)
+		}
+		if res.Binary.Name != "app" || res.Signature.Name != "app.msign" {
+			t.Errorf("%s: unexpected assets %v, %v", test.current, res.Binary, res.Signature)
+		}
+	}
+}
+
+func TestUpdaterApplyNoUpdate(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(target, []byte("v1.2.0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	src := &memSource{releases: []Release{{TagName: "v1.2.0"}, {TagName: "v1.3.0"}}}
+	u, err := New(WithSource(src), WithBinary("app"), WithCurrentVersion("v1.2.0"), WithTarget(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := u.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != ActionNone || res.Status != StatusUpToDate {
+		t.Errorf("unexpected result %+v", res)
+	}
+
+	u, _ = New(WithSource(src), WithBinary("app"), WithCurrentVersion("v1.2.0"), WithTarget(target), WithVersion("v1.3.0"))
+	if _, err = u.Apply(context.Background()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error for missing binary asset, got %v", err)
+	}
+}
+
+func TestWrappers(t *testing.T) {
+	src := &memSource{releases: []Release{
+		{TagName: "v1.3.0-rc.1", PreRelease: true},
+		{TagName: "v1.2.0"},
+	}}
+
+	version, err := GetLatestVersionFrom(src, ChannelPrerelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "v1.3.0-rc.1" {
+		t.Errorf("unexpected latest version %q", version)
+	}
+
+	// The release has no binary asset, nothing is installed
+	err = DownloadVersionFrom(src, "v1.2.0", "app", "v1.1.0", false, &BackupStore{Dir: t.TempDir()}, nil)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error for missing binary asset, got %v", err)
+	}
+}
+
+func TestUpdaterRollback(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	store := &BackupStore{Dir: filepath.Join(dir, "backups")}
+
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		if err := os.WriteFile(target+backupExt, []byte(version), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.add(target, target+backupExt, Backup{Version: version}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(target, []byte("v1.2.0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := New(WithCurrentVersion("v1.2.0"), WithTarget(target), WithBackupStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = u.Rollback(context.Background(), "v0.9.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	res, err := u.Rollback(context.Background(), "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Restored.Version != "v1.0.0" || res.Verified || res.Backup.Version != "v1.2.0" {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if cont, _ := os.ReadFile(target); string(cont) != "v1.0.0" {
+		t.Errorf("unexpected target content %q", cont)
+	}
+
+	backups, err := u.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Version != "v1.2.0" || backups[1].Version != "v1.1.0" {
+		t.Errorf("unexpected history %+v", backups)
+	}
+}
+
+func TestUpdaterRollbackLeftBackup(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	store := &BackupStore{Dir: filepath.Join(dir, "backups")}
+
+	// The backup left by an update without the store
+	priv, pub := testKey(t)
+	info, err := json.Marshal(map[string]string{"version": "v1.1.0", "signature": string(testSign(t, priv, []byte("v1.1.0")))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, cont := range map[string][]byte{target: []byte("v1.2.0"), target + backupExt: []byte("v1.1.0"), target + backupExt + backupInfoExt: info} {
+		if err = os.WriteFile(file, cont, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, err := New(WithCurrentVersion("v1.2.0"), WithTarget(target), WithBackupStore(store), WithPublicKeys(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = u.Rollback(context.Background(), "v1.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	res, err := u.Rollback(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Restored.Version != "v1.1.0" || !res.Verified || res.Backup.Version != "v1.2.0" {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if cont, _ := os.ReadFile(target); string(cont) != "v1.1.0" {
+		t.Errorf("unexpected target content %q", cont)
+	}
+	for _, file := range []string{target + backupExt, target + backupExt + backupInfoExt} {
+		if _, err = os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s is left: %v", file, err)
+		}
+	}
+}
+
+func TestUpdaterPlan(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	if err := os.WriteFile(target, []byte("v1.0.0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &BackupStore{Dir: filepath.Join(dir, "backups")}
+	u, err := New(WithCurrentVersion("v1.0.0"), WithTarget(target), WithBackupStore(store), WithDryRun(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := &ApplyResult{Target: target}
+	if err = u.plan(res); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Rename{
+		{From: target, To: target + backupExt},
+		{From: target + newExt, To: target},
+		{From: target + backupExt, To: filepath.Join(store.Dir, "v1.0.0", "app")},
+	}
+	if res.Action != ActionPlanned || len(res.Plan) != len(expected) {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	for i := range expected {
+		if res.Plan[i] != expected[i] {
+			t.Errorf("step %d: got %v, expected %v", i, res.Plan[i], expected[i])
+		}
+	}
+
+	if _, err = os.Stat(store.Dir); !os.IsNotExist(err) {
+		t.Errorf("backup store is created by the plan: %v", err)
+	}
+
+	if err = u.plan(&ApplyResult{Target: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected error for missing target")
+	}
+}
+
+func TestUpdaterApplyDryRun(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app")
+	// The partial download of an interrupted update
+	files := map[string]string{
+		target:                             "v1.0.0",
+		target + newExt:                    "v1.",
+		target + newExt + downloadStateExt: `{"url":"app","size":6,"etag":"1"}`,
+	}
+	for file, cont := range files {
+		if err := os.WriteFile(file, []byte(cont), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	priv, pub := testKey(t)
+	binary := []byte("v1.1.0")
+	src := &memSource{
+		releases: []Release{{TagName: "v1.1.0", Assets: []Asset{
+			{Name: "app", URL: "app", Size: int64(len(binary))},
+			{Name: "app" + signExt, URL: "app.msign"},
+		}}},
+		data: map[string][]byte{"app": binary, "app.msign": testSign(t, priv, binary)},
+	}
+
+	u, err := New(WithSource(src), WithBinary("app"), WithCurrentVersion("v1.0.0"), WithTarget(target), WithDryRun(true), WithPublicKeys(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := u.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != ActionPlanned || len(res.Plan) != 3 {
+		t.Errorf("unexpected result %+v", res)
+	}
+
+	// The dry run leaves the target directory as it is
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(files) {
+		t.Errorf("unexpected files %v", entries)
+	}
+	for file, expected := range files {
+		if cont, _ := os.ReadFile(file); string(cont) != expected {
+			t.Errorf("unexpected %s content %q", filepath.Base(file), cont)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version (https://semver.org) parsed from a release
+// tag. The "v" prefix is optional, missing minor and patch numbers are
+// treated as zeros.
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	PreRelease []string
+	Build      string
+}
+
+// ParseVersion parses tag as a semantic version.
+func ParseVersion(tag string) (Version, error) {
+	var v Version
+
+	s := strings.TrimPrefix(strings.TrimSpace(tag), "v")
+	if n := strings.IndexByte(s, '+'); n >= 0 {
+		v.Build = s[n+1:]
+		s = s[:n]
+		if v.Build == "" {
+			return Version{}, fmt.Errorf("invalid version %q: empty build metadata", tag)
+		}
+	}
+	if n := strings.IndexByte(s, '-'); n >= 0 {
+		v.PreRelease = strings.Split(s[n+1:], ".")
+		s = s[:n]
+		for _, id := range v.PreRelease {
+			if id == "" {
+				return Version{}, fmt.Errorf("invalid version %q: empty prerelease identifier", tag)
+			}
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q", tag)
+	}
+
+	nums := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q", tag)
+		}
+		*nums[i] = n
+	}
+
+	return v, nil
+}
+
+// Compare returns -1, 0 or +1 if v is lower, equal or higher than o.
+// Build metadata does not affect the precedence.
+func (v Version) Compare(o Version) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	// A version without prerelease has higher precedence
+	switch {
+	case len(v.PreRelease) == 0 && len(o.PreRelease) == 0:
+		return 0
+	case len(v.PreRelease) == 0:
+		return 1
+	case len(o.PreRelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.PreRelease) && i < len(o.PreRelease); i++ {
+		if c := comparePreRelease(v.PreRelease[i], o.PreRelease[i]); c != 0 {
+			return c
+		}
+	}
+
+	return compareUint(uint64(len(v.PreRelease)), uint64(len(o.PreRelease)))
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.PreRelease) > 0 {
+		s += "-" + strings.Join(v.PreRelease, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// compareVersions compares two release tags. ok is false if any of them
+// is not a semantic version.
+func compareVersions(a, b string) (c int, ok bool) {
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, false
+	}
+
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, false
+	}
+
+	return va.Compare(vb), true
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePreRelease compares prerelease identifiers: numeric ones are
+// compared numerically and have lower precedence than alphanumeric ones.
+func comparePreRelease(a, b string) int {
+	na, erra := strconv.ParseUint(a, 10, 64)
+	nb, errb := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case erra == nil && errb == nil:
+		return compareUint(na, nb)
+	case erra == nil:
+		return -1
+	case errb == nil:
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,58 @@
+//go:build selfupdate
+// +build selfupdate
+
+package selfupdate
+
+import (
+	"testing"
+)
+
+func TestVersionCompare(t *testing.T) {
+	// ordered from the lowest to the highest precedence
+	ordered := []string{
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"1.0.0",
+		"v1.0.1",
+		"v1.2",
+		"v1.10.0",
+		"v2",
+	}
+
+	for i := range ordered {
+		for j := range ordered {
+			c, ok := compareVersions(ordered[i], ordered[j])
+			if !ok {
+				t.Fatalf("failed to compare %q and %q", ordered[i], ordered[j])
+			}
+			if expected := compareUint(uint64(i), uint64(j)); c != expected {
+				t.Errorf("compare %q and %q: got %d, expected %d", ordered[i], ordered[j], c, expected)
+			}
+		}
+	}
+
+	if c, ok := compareVersions("v1.0.0+build.1", "v1.0.0+build.2"); !ok || c != 0 {
+		t.Errorf("build metadata should not affect precedence, got %d", c)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("v1.2.3-rc.1+linux.amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "1.2.3-rc.1+linux.amd64" {
+		t.Errorf("unexpected version %v", v)
+	}
+
+	for _, tag := range []string{"DEVBUILD", "not set", "", "v1.2.3.4", "v1.2.3-", "v1.2.3+", "v1..2", "v1.0.0-rc..1"} {
+		if _, err := ParseVersion(tag); err == nil {
+			t.Errorf("%q: expected error", tag)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build selfupdate && !windows
+// +build selfupdate,!windows
+
+package selfupdate
+
+import (
+	"os"
+	"syscall"
+)
+
+// accessWrite is W_OK mode of access(2).
+const accessWrite = 0x2
+
+// writable checks that the current user is permitted to write to path.
+func writable(path string) error {
+	if err := syscall.Access(path, accessWrite); err != nil {
+		return &os.PathError{Op: "access", Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build selfupdate && windows
+// +build selfupdate,windows
+
+package selfupdate
+
+import (
+	"os"
+)
+
+// writable checks that path is not read-only.
+func writable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode().Perm()&0200 == 0 {
+		return &os.PathError{Op: "access", Path: path, Err: os.ErrPermission}
+	}
+	return nil
+}